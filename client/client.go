@@ -1,50 +1,53 @@
 package client
 
 import (
-	"fmt"
 	"os"
+	"time"
 
-	"github.com/henrytk/calendar-resource/errors"
 	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
 )
 
 // CalendarClient is an interface that must be satisfied in order to
-// implement other calendar providers.
+// implement other calendar providers. Providers make themselves available
+// with Register. Most providers need only implement Provider, converting
+// their events to models.Event, and use an EventClient.
 type CalendarClient interface {
 
+	// Each method takes a context which is cancelled when the command times
+	// out or is terminated. Providers should pass it to any API calls.
+	//
 	// ListEvents takes a resource version and returns a list of resource versions.
 	// It is assumed each calendar provider will provide some form of unique
 	// identifier for each event. This identifier is used as the Concourse
 	// resource version.
 	//
-	// If the requestedVersion is an event which is currently happening then
-	// ListEvents should return a list containing just that version. Otherwise,
-	// it should return a list containing all current versions.
-	ListEvents(requestedVersion models.Version) []models.Version
+	// Versions must be ordered by event start time. If a requestedVersion is
+	// given ListEvents should return a list beginning with that version,
+	// followed by every newer version. Otherwise, it should return a list
+	// containing all current versions.
+	ListEvents(ctx context.Context, requestedVersion models.Version) ([]models.Version, error)
 
 	// GetEvent takes the `in` request data and a directory path under which
 	// a file will be created. It uses the calendar provider's API to get
 	// the event details necessary to provide a response on standard output
 	// and populate a file. The file will then be placed in the Concourse
 	// task's file system.
-	GetEvent(*models.InRequest, string) (models.InResponse, *os.File, error)
+	GetEvent(context.Context, *models.InRequest, string) (models.InResponse, *os.File, error)
 
 	// AddEvent takes an `out` request and the path to the build sources and
 	// creates a calendar event. The calendar client must make its own data
-	// structures to hold the data passed in via `params`. It must os.Exit
-	// if any error condition is encountered. It should return an OutResponse,
-	// which is a single resource version (identified by an ID) representing
-	// the created event.
-	AddEvent(*models.OutRequest, string) models.OutResponse
+	// structures to hold the data passed in via `params`. It should return an
+	// OutResponse, which is a single resource version (identified by an ID)
+	// representing the created event.
+	AddEvent(context.Context, *models.OutRequest, string) (models.OutResponse, error)
 }
 
-func NewCalendarClient(source models.Source, args ...string) CalendarClient {
-	var client CalendarClient
-	switch source.Provider {
-	case "google":
-		client = NewGoogleCalendarClient(source, args[0])
-	default:
-		errors.Fatal("Provider error: ", fmt.Errorf("Provider '%v' is not supported", source.Provider))
+// parseDuration parses an optional duration from the source configuration,
+// returning zero if it is empty.
+func parseDuration(duration string) (time.Duration, error) {
+	if duration == "" {
+		return 0, nil
 	}
-	return client
+	return time.ParseDuration(duration)
 }
@@ -0,0 +1,90 @@
+// Package clientfake provides an in-memory CalendarClient for testing the
+// check, in and out commands without a calendar provider.
+package clientfake
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/henrytk/calendar-resource/client"
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+// CalendarClient returns canned versions and events, and records the
+// requests made of it.
+type CalendarClient struct {
+	// Versions is returned by ListEvents.
+	Versions []models.Version
+	// MetaData holds the metadata GetEvent returns for each version ID.
+	MetaData map[string][]models.KeyValuePair
+	// AddedVersion is returned by AddEvent.
+	AddedVersion models.Version
+	// FactoryErr is returned by the Factory instead of the client.
+	FactoryErr error
+	// Err is returned by ListEvents, GetEvent and AddEvent if set.
+	Err error
+
+	Source           models.Source
+	Options          client.Options
+	RequestedVersion models.Version
+	InRequest        *models.InRequest
+	OutRequest       *models.OutRequest
+	BuildSourcePath  string
+}
+
+// Factory returns a client.Factory which records the source and options it
+// is called with and returns c.
+func (c *CalendarClient) Factory() client.Factory {
+	return func(ctx context.Context, source models.Source, options client.Options) (client.CalendarClient, error) {
+		c.Source = source
+		c.Options = options
+		if c.FactoryErr != nil {
+			return nil, c.FactoryErr
+		}
+		return c, nil
+	}
+}
+
+func (c *CalendarClient) ListEvents(ctx context.Context, requestedVersion models.Version) ([]models.Version, error) {
+	c.RequestedVersion = requestedVersion
+	if c.Err != nil {
+		return nil, c.Err
+	}
+	return c.Versions, nil
+}
+
+func (c *CalendarClient) GetEvent(ctx context.Context, inRequest *models.InRequest, targetDirectory string) (models.InResponse, *os.File, error) {
+	c.InRequest = inRequest
+	if c.Err != nil {
+		return models.InResponse{}, nil, c.Err
+	}
+	metaData, ok := c.MetaData[inRequest.Version.Id]
+	if !ok {
+		return models.InResponse{}, nil, fmt.Errorf("event '%v' not found", inRequest.Version.Id)
+	}
+	inResponse := models.InResponse{
+		Version:  inRequest.Version,
+		MetaData: metaData,
+	}
+	file, err := os.Create(filepath.Join(targetDirectory, "input"))
+	if err != nil {
+		return models.InResponse{}, nil, err
+	}
+	if err := json.NewEncoder(file).Encode(inResponse); err != nil {
+		file.Close()
+		return models.InResponse{}, nil, err
+	}
+	return inResponse, file, nil
+}
+
+func (c *CalendarClient) AddEvent(ctx context.Context, outRequest *models.OutRequest, buildSourcePath string) (models.OutResponse, error) {
+	c.OutRequest = outRequest
+	c.BuildSourcePath = buildSourcePath
+	if c.Err != nil {
+		return models.OutResponse{}, c.Err
+	}
+	return models.OutResponse{Version: c.AddedVersion}, nil
+}
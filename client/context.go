@@ -0,0 +1,45 @@
+package client
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+const defaultTimeout = 5 * time.Minute
+
+// NewContext returns the context a command passes to its calendar client,
+// which is cancelled once the source's timeout elapses.
+func NewContext(parent context.Context, source models.Source) (context.Context, context.CancelFunc, error) {
+	timeout, err := parseDuration(source.Timeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parsing timeout: %v", err)
+	}
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	return ctx, cancel, nil
+}
+
+// SignalContext returns a context which is cancelled when the command
+// receives SIGTERM or SIGINT, for example when Concourse aborts a build.
+func SignalContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		select {
+		case <-signals:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signals)
+	}()
+	return ctx, cancel
+}
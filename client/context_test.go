@@ -0,0 +1,26 @@
+package client
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+func TestNewContext(t *testing.T) {
+	ctx, cancel, err := NewContext(context.Background(), models.Source{Timeout: "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cancel()
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Minute {
+		t.Errorf("expected a deadline within a minute, got %v", deadline)
+	}
+
+	if _, _, err := NewContext(context.Background(), models.Source{Timeout: "soon"}); err == nil || !strings.Contains(err.Error(), "parsing timeout") {
+		t.Errorf("expected a malformed timeout to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package client
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/henrytk/calendar-resource/models"
+)
+
+// resolveCredentials loads the source's credentials from credentials_file or
+// credentials_env when they are not given inline, and decodes credentials
+// which are base64 encoded or supplied as a string rather than an object.
+func resolveCredentials(source models.Source) (models.Source, error) {
+	credentials := []byte(source.Credentials)
+	switch {
+	case source.CredentialsFile != "":
+		contents, err := ioutil.ReadFile(source.CredentialsFile)
+		if err != nil {
+			return source, err
+		}
+		credentials = contents
+	case source.CredentialsEnv != "":
+		value, ok := os.LookupEnv(source.CredentialsEnv)
+		if !ok {
+			return source, fmt.Errorf("environment variable '%v' is not set", source.CredentialsEnv)
+		}
+		credentials = []byte(value)
+	}
+	if len(bytes.TrimSpace(credentials)) == 0 {
+		return source, nil
+	}
+	decoded, err := decodeCredentials(credentials)
+	if err != nil {
+		return source, err
+	}
+	source.Credentials = decoded
+	return source, nil
+}
+
+func decodeCredentials(credentials []byte) (json.RawMessage, error) {
+	credentials = bytes.TrimSpace(credentials)
+	switch {
+	case bytes.HasPrefix(credentials, []byte("{")):
+		return json.RawMessage(credentials), nil
+	case bytes.HasPrefix(credentials, []byte(`"`)):
+		var value string
+		if err := json.Unmarshal(credentials, &value); err != nil {
+			return nil, err
+		}
+		return decodeCredentials([]byte(value))
+	}
+	decoded, err := base64.StdEncoding.DecodeString(string(credentials))
+	if err != nil {
+		return nil, fmt.Errorf("credentials are neither JSON nor base64 encoded JSON")
+	}
+	decoded = bytes.TrimSpace(decoded)
+	if !bytes.HasPrefix(decoded, []byte("{")) {
+		return nil, fmt.Errorf("base64 encoded credentials do not contain JSON")
+	}
+	return json.RawMessage(decoded), nil
+}
@@ -0,0 +1,114 @@
+package client
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/henrytk/calendar-resource/models"
+)
+
+const testCredentials = `{"type": "service_account", "client_email": "calendar@example.com"}`
+
+func TestResolveCredentials(t *testing.T) {
+	file, err := ioutil.TempFile("", "credentials")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.WriteString("\n" + testCredentials + "\n"); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	os.Setenv("CALENDAR_RESOURCE_TEST_CREDENTIALS", base64.StdEncoding.EncodeToString([]byte(testCredentials)))
+	defer os.Unsetenv("CALENDAR_RESOURCE_TEST_CREDENTIALS")
+	quoted, _ := json.Marshal(testCredentials)
+	doubleQuoted, _ := json.Marshal(string(quoted))
+
+	for _, test := range []struct {
+		name        string
+		source      models.Source
+		expected    string
+		expectedErr string
+	}{
+		{
+			name:     "inline JSON",
+			source:   models.Source{Credentials: json.RawMessage(testCredentials)},
+			expected: testCredentials,
+		},
+		{
+			name:     "a JSON string wrapping JSON",
+			source:   models.Source{Credentials: json.RawMessage(quoted)},
+			expected: testCredentials,
+		},
+		{
+			name:     "a JSON string wrapping a JSON string",
+			source:   models.Source{Credentials: json.RawMessage(doubleQuoted)},
+			expected: testCredentials,
+		},
+		{
+			name:     "a base64 encoded string",
+			source:   models.Source{Credentials: json.RawMessage(`"` + base64.StdEncoding.EncodeToString([]byte(testCredentials)) + `"`)},
+			expected: testCredentials,
+		},
+		{
+			name:     "a file",
+			source:   models.Source{CredentialsFile: file.Name()},
+			expected: testCredentials,
+		},
+		{
+			name:     "an environment variable",
+			source:   models.Source{CredentialsEnv: "CALENDAR_RESOURCE_TEST_CREDENTIALS"},
+			expected: testCredentials,
+		},
+		{
+			name:     "no credentials",
+			source:   models.Source{},
+			expected: "",
+		},
+		{
+			name:        "a missing file",
+			source:      models.Source{CredentialsFile: file.Name() + "-missing"},
+			expectedErr: "no such file or directory",
+		},
+		{
+			name:        "a missing environment variable",
+			source:      models.Source{CredentialsEnv: "CALENDAR_RESOURCE_TEST_MISSING"},
+			expectedErr: "environment variable 'CALENDAR_RESOURCE_TEST_MISSING' is not set",
+		},
+		{
+			name:        "base64 which doesn't contain JSON",
+			source:      models.Source{Credentials: json.RawMessage(`"` + base64.StdEncoding.EncodeToString([]byte("not json")) + `"`)},
+			expectedErr: "base64 encoded credentials do not contain JSON",
+		},
+		{
+			name:        "neither JSON nor base64",
+			source:      models.Source{Credentials: json.RawMessage(`"not base64!"`)},
+			expectedErr: "credentials are neither JSON nor base64 encoded JSON",
+		},
+		{
+			name:        "a malformed JSON string",
+			source:      models.Source{Credentials: json.RawMessage(`"unterminated`)},
+			expectedErr: "unexpected end of JSON input",
+		},
+	} {
+		source, err := resolveCredentials(test.source)
+		if test.expectedErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+				t.Errorf("%v: expected error containing %q, got %v", test.name, test.expectedErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", test.name, err)
+			continue
+		}
+		if string(source.Credentials) != test.expected {
+			t.Errorf("%v: expected credentials %v, got %s", test.name, test.expected, source.Credentials)
+		}
+	}
+}
@@ -0,0 +1,530 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+// dateLayout formats the dates of all-day events.
+const dateLayout = "2006-01-02"
+
+// Provider is the interface a calendar provider implements to be wrapped by
+// an EventClient. It converts between the provider's API and models.Event.
+type Provider interface {
+
+	// Events returns the events in a calendar which end after timeMin and
+	// start before timeMax, ordered by start time. Recurring events are
+	// expanded into their individual occurrences.
+	Events(ctx context.Context, calendarId string, timeMin, timeMax time.Time) ([]models.Event, error)
+
+	// Event returns a single event from a calendar.
+	Event(ctx context.Context, calendarId, eventId string) (models.Event, error)
+
+	// InsertEvent creates an event in a calendar and returns it as created.
+	InsertEvent(ctx context.Context, calendarId string, event models.Event) (models.Event, error)
+}
+
+type byEventStart []models.Event
+
+func (e byEventStart) Len() int           { return len(e) }
+func (e byEventStart) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e byEventStart) Less(i, j int) bool { return e[i].Start.Before(e[j].Start) }
+
+// CalendarLister may be implemented by a Provider to allow calendars to be
+// identified by name rather than by ID.
+type CalendarLister interface {
+
+	// Calendars returns the calendars the provider's account can access.
+	Calendars(ctx context.Context) ([]models.Calendar, error)
+}
+
+// EventClient implements CalendarClient for any Provider, so that matching
+// events, building versions and writing output is shared by all providers.
+type EventClient struct {
+	Source   models.Source
+	Provider Provider
+}
+
+func NewEventClient(source models.Source, provider Provider) CalendarClient {
+	return &EventClient{
+		Source:   source,
+		Provider: provider,
+	}
+}
+
+func (ec *EventClient) ListEvents(ctx context.Context, requestedVersion models.Version) ([]models.Version, error) {
+	if err := checkVersion(requestedVersion); err != nil {
+		return nil, err
+	}
+	if err := ec.resolveCalendarName(ctx); err != nil {
+		return nil, err
+	}
+	minInterval, err := parseDuration(ec.Source.MinInterval)
+	if err != nil {
+		return nil, fmt.Errorf("parsing min_interval: %v", err)
+	}
+	versions, err := ec.listVersions(ctx, requestedVersion)
+	if err != nil {
+		return nil, err
+	}
+	return debounce(versions, minInterval), nil
+}
+
+func (ec *EventClient) listVersions(ctx context.Context, requestedVersion models.Version) ([]models.Version, error) {
+	var currentVersions []models.Version
+	now := time.Now()
+	if ec.Source.Mode == ModeFreeBusy {
+		blocking, err := ec.gateEvents(ctx, now, now.Add(time.Nanosecond))
+		if err != nil {
+			return nil, err
+		}
+		if blockedAt(blocking, now) {
+			return versionsSince(requestedVersion, nil, ec.Source.InitialVersion, now), nil
+		}
+		return ec.freeBusyVersions(ctx, requestedVersion, now)
+	}
+	lookback, err := parseDuration(ec.Source.Lookback)
+	if err != nil {
+		return nil, fmt.Errorf("parsing lookback: %v", err)
+	}
+	// Events which ended within the lookback are still emitted, so that
+	// those missed while checks weren't running trigger late.
+	timeMin := now.Add(-lookback)
+	changeFeed := ec.Source.TriggerOn == TriggerOnCreated || ec.Source.TriggerOn == TriggerOnUpdated
+	timeMax := now.Add(time.Nanosecond)
+	if changeFeed {
+		// Changes to any event which has not yet ended are of interest.
+		timeMax = now.Add(changeFeedHorizon)
+	}
+	var events []models.Event
+	if ec.Source.CoalesceGap != "" {
+		gap, err := parseDuration(ec.Source.CoalesceGap)
+		if err != nil {
+			return nil, fmt.Errorf("parsing coalesce_gap: %v", err)
+		}
+		events, err = ec.coalesce(ctx, gap, timeMin, timeMax)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		events, err = ec.matchingEvents(ctx, timeMin, timeMax)
+		if err != nil {
+			return nil, err
+		}
+	}
+	discardBlocked := ec.Source.Gate != nil && ec.Source.Gate.DiscardBlocked
+	gateMin := now
+	if discardBlocked {
+		// Blocking events are fetched back to the earliest candidate's
+		// start, so that events which started during a freeze which has
+		// since ended are still discarded.
+		for _, event := range events {
+			if event.Start.Before(gateMin) {
+				gateMin = event.Start
+			}
+		}
+	}
+	blocking, err := ec.gateEvents(ctx, gateMin, timeMax)
+	if err != nil {
+		return nil, err
+	}
+	if blockedAt(blocking, now) {
+		return versionsSince(requestedVersion, nil, ec.Source.InitialVersion, now), nil
+	}
+	for _, event := range events {
+		if !event.End.After(timeMin) {
+			continue
+		}
+		if !changeFeed && event.Start.After(now) {
+			continue
+		}
+		if discardBlocked && blockedAt(blocking, event.Start) {
+			continue
+		}
+		currentVersions = append(currentVersions, ec.eventVersion(event.CalendarId, event))
+	}
+	return versionsSince(requestedVersion, currentVersions, ec.Source.InitialVersion, now), nil
+}
+
+// matchingEvents returns the events the source triggers on from all of its
+// calendars which end after timeMin and start before timeMax, ordered by
+// start time.
+func (ec *EventClient) matchingEvents(ctx context.Context, timeMin, timeMax time.Time) ([]models.Event, error) {
+	var matching []models.Event
+	for _, calendarId := range ec.Source.Calendars() {
+		events, err := ec.Provider.Events(ctx, calendarId, timeMin, timeMax)
+		if err != nil {
+			return nil, fmt.Errorf("getting events using calendar client: %v", err)
+		}
+		for _, event := range events {
+			matches, err := ec.matches(event)
+			if err != nil {
+				return nil, err
+			}
+			if matches && event.End.After(timeMin) {
+				event.CalendarId = calendarId
+				matching = append(matching, event)
+			}
+		}
+	}
+	sort.Stable(byEventStart(matching))
+	return matching, nil
+}
+
+// coalesce merges matching events which overlap or are separated by no
+// more than gap into a single event, identified by the first of them and
+// ending with the last. Events up to gap either side of the time range are
+// included, so that a window is still found between two of its events, and
+// earlier events are fetched until the start of the window which reaches
+// back furthest is known, so that its version doesn't change as its first
+// events end.
+func (ec *EventClient) coalesce(ctx context.Context, gap time.Duration, timeMin, timeMax time.Time) ([]models.Event, error) {
+	// Events which end exactly gap before another still join it.
+	from := timeMin.Add(-gap - time.Nanosecond)
+	timeMax = timeMax.Add(gap)
+	for {
+		events, err := ec.matchingEvents(ctx, from, timeMax)
+		if err != nil {
+			return nil, err
+		}
+		windows := mergeEvents(events, gap)
+		if len(windows) == 0 {
+			return windows, nil
+		}
+		earlier := windows[0].Start.Add(-gap - time.Nanosecond)
+		if !earlier.Before(from) || timeMin.Sub(earlier) > coalesceMaxLookback {
+			return windows, nil
+		}
+		from = earlier
+	}
+}
+
+func mergeEvents(events []models.Event, gap time.Duration) []models.Event {
+	var windows []models.Event
+	for _, event := range events {
+		last := len(windows) - 1
+		if last >= 0 && !event.Start.After(windows[last].End.Add(gap)) {
+			if event.End.After(windows[last].End) {
+				windows[last].End = event.End
+			}
+			continue
+		}
+		windows = append(windows, event)
+	}
+	return windows
+}
+
+// resolveCalendarName sets the source's calendar ID from its calendar_name,
+// failing if no calendar or more than one calendar has that name.
+func (ec *EventClient) resolveCalendarName(ctx context.Context) error {
+	name := ec.Source.CalendarName
+	if name == "" || ec.Source.CalendarId != "" {
+		return nil
+	}
+	lister, ok := ec.Provider.(CalendarLister)
+	if !ok {
+		return fmt.Errorf("resolving calendar_name: Provider '%v' does not support calendar_name", ec.Source.Provider)
+	}
+	calendars, err := lister.Calendars(ctx)
+	if err != nil {
+		return fmt.Errorf("listing calendars using calendar client: %v", err)
+	}
+	var matches []string
+	for _, calendar := range calendars {
+		if calendar.Name == name {
+			matches = append(matches, calendar.Id)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return fmt.Errorf("resolving calendar_name: No calendar named '%v' is accessible", name)
+	case 1:
+		ec.Source.CalendarId = matches[0]
+		return nil
+	default:
+		return fmt.Errorf("resolving calendar_name: %d calendars are named '%v': %v. Use calendar_id instead", len(matches), name, strings.Join(matches, ", "))
+	}
+}
+
+// eventVersion builds the version for an event, namespacing it by calendar
+// when the source has several and recording when it changed when
+// triggering on changes.
+func (ec *EventClient) eventVersion(calendarId string, event models.Event) models.Version {
+	version := newVersion(event.Id, event.Start)
+	if len(ec.Source.CalendarIds) > 0 {
+		version.CalendarId = calendarId
+	}
+	switch ec.Source.TriggerOn {
+	case TriggerOnCreated:
+		version.Changed = event.Created.UTC().Format(time.RFC3339Nano)
+	case TriggerOnUpdated:
+		version.Changed = event.Updated.UTC().Format(time.RFC3339Nano)
+	}
+	return version
+}
+
+// gateEvents returns the blocking events in the calendar configured as the
+// source's gate which end after timeMin and start before timeMax.
+func (ec *EventClient) gateEvents(ctx context.Context, timeMin, timeMax time.Time) ([]models.Event, error) {
+	gate := ec.Source.Gate
+	if gate == nil {
+		return nil, nil
+	}
+	events, err := ec.Provider.Events(ctx, gate.CalendarId, timeMin, timeMax)
+	if err != nil {
+		return nil, fmt.Errorf("getting gate events using calendar client: %v", err)
+	}
+	var blocking []models.Event
+	for _, event := range events {
+		if gate.EventName == "" || event.Summary == gate.EventName {
+			blocking = append(blocking, event)
+		}
+	}
+	return blocking, nil
+}
+
+// blockedAt reports whether any of the blocking events is happening at the
+// given time.
+func blockedAt(blocking []models.Event, at time.Time) bool {
+	for _, event := range blocking {
+		if event.Active(at) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ec *EventClient) GetEvent(ctx context.Context, inRequest *models.InRequest, targetDirectory string) (models.InResponse, *os.File, error) {
+	if inRequest.Version.Id == "" {
+		return models.InResponse{}, nil, fmt.Errorf("fetching resource version: calendar event ID not specified")
+	}
+	var getEventParams GetEventParams
+	if len(inRequest.Params) > 0 {
+		if err := json.Unmarshal(inRequest.Params, &getEventParams); err != nil {
+			return models.InResponse{}, nil, fmt.Errorf("decoding get params: %v", err)
+		}
+	}
+	if err := ec.resolveCalendarName(ctx); err != nil {
+		return models.InResponse{}, nil, err
+	}
+	var metadata []models.KeyValuePair
+	switch {
+	case inRequest.Version.Id == initialMarkerId:
+	case ec.Source.Mode == ModeFreeBusy:
+		metadata = ec.freeBusyMetadata(inRequest.Version)
+	default:
+		calendarId := inRequest.Version.CalendarId
+		if calendarId == "" {
+			calendarId = ec.Source.CalendarId
+		}
+		event, err := ec.Provider.Event(ctx, calendarId, inRequest.Version.Id)
+		if err != nil {
+			return models.InResponse{}, nil, fmt.Errorf("getting event using calendar client: %v", err)
+		}
+		if err := getEventParams.RequireAcceptedBy.check(event); err != nil {
+			return models.InResponse{}, nil, err
+		}
+		metadata = eventMetadata(event)
+	}
+	if getEventParams.OnCall != nil {
+		if err := ec.writeOnCall(ctx, *getEventParams.OnCall, time.Now(), targetDirectory); err != nil {
+			return models.InResponse{}, nil, err
+		}
+	}
+	return writeInput(models.InResponse{
+		Version:  inRequest.Version,
+		MetaData: metadata,
+	}, targetDirectory)
+}
+
+// writeInput writes the response of a get step to the input file in the
+// target directory.
+func writeInput(inResponse models.InResponse, targetDirectory string) (models.InResponse, *os.File, error) {
+	file, err := os.Create(filepath.Join(targetDirectory, "input"))
+	if err != nil {
+		return models.InResponse{}, nil, fmt.Errorf("creating input file: %v", err)
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(inResponse); err != nil {
+		return models.InResponse{}, nil, fmt.Errorf("writing input file: %v", err)
+	}
+	return inResponse, file, nil
+}
+
+// eventMetadata formats an event as the metadata shown by Concourse and
+// written to the input file.
+func eventMetadata(event models.Event) []models.KeyValuePair {
+	keyValuePairs := []models.KeyValuePair{
+		{Name: "time_zone", Value: event.TimeZone},
+		{Name: "start", Value: formatEventTime(event.Start, event.AllDay)},
+		{Name: "end", Value: formatEventTime(event.End, event.AllDay)},
+		{Name: "created", Value: formatTime(event.Created)},
+		{Name: "description", Value: event.Description},
+	}
+	if event.Location != "" {
+		keyValuePairs = append(keyValuePairs, models.KeyValuePair{Name: "location", Value: event.Location})
+	}
+	var properties []string
+	for name := range event.Properties {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+	for _, name := range properties {
+		keyValuePairs = append(keyValuePairs, models.KeyValuePair{Name: name, Value: event.Properties[name]})
+	}
+	return append(keyValuePairs, models.KeyValuePair{Name: "summary", Value: event.Summary})
+}
+
+func formatEventTime(t time.Time, allDay bool) string {
+	if allDay {
+		return t.Format(dateLayout)
+	}
+	return formatTime(t)
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+// GetEventParams holds data passed in via `params` from a get step.
+type GetEventParams struct {
+	RequireAcceptedBy Acceptance    `json:"require_accepted_by,omitempty"`
+	OnCall            *OnCallParams `json:"on_call,omitempty"`
+}
+
+// Acceptance lists the attendees who must have accepted an event, or how
+// many attendees must have. It is decoded from a list of email addresses, a
+// single email address or a number.
+type Acceptance struct {
+	Emails []string
+	Count  int
+}
+
+func (a *Acceptance) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Count); err == nil {
+		if a.Count < 0 {
+			return fmt.Errorf("require_accepted_by must not be negative")
+		}
+		return nil
+	}
+	var email string
+	if err := json.Unmarshal(data, &email); err == nil {
+		a.Emails = []string{email}
+		return nil
+	}
+	if err := json.Unmarshal(data, &a.Emails); err != nil {
+		return fmt.Errorf("require_accepted_by must be a number or a list of email addresses")
+	}
+	return nil
+}
+
+// check returns an error unless the event has been accepted as required.
+func (a Acceptance) check(event models.Event) error {
+	accepted := map[string]bool{}
+	for _, attendee := range event.Attendees {
+		if attendee.ResponseStatus == "accepted" && !attendee.Resource {
+			accepted[strings.ToLower(attendee.Email)] = true
+		}
+	}
+	var missing []string
+	for _, email := range a.Emails {
+		if !accepted[strings.ToLower(email)] {
+			missing = append(missing, email)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Event '%v' has not been accepted by %v", event.Summary, strings.Join(missing, ", "))
+	}
+	if len(accepted) < a.Count {
+		return fmt.Errorf("Event '%v' has been accepted by %d attendees, but %d are required", event.Summary, len(accepted), a.Count)
+	}
+	return nil
+}
+
+// AddEventParams holds data passed in via `params` from the
+// Conncourse task. StartTime and EndTime must be an RFC3339
+// formatted time string. For example, "2016-10-15T08:00:00+01:00"
+type AddEventParams struct {
+	Attendees   []string `json:"attendees,omitempty"`
+	CalendarId  string   `json:"calendar_id,omitempty"`
+	Description string   `json:"description,omitempty"`
+	EndTime     string   `json:"end_time"`
+	Location    string   `json:"location,omitempty"`
+	StartTime   string   `json:"start_time"`
+	Summary     string   `json:"summary,omitempty"`
+	TimeZone    string   `json:"time_zone,omitempty"`
+}
+
+// Event converts the params to the event to be added.
+func (params AddEventParams) Event() (models.Event, error) {
+	if params.StartTime == "" || params.EndTime == "" {
+		return models.Event{}, fmt.Errorf("You must supply an event start and end time")
+	}
+	start, err := time.Parse(time.RFC3339, params.StartTime)
+	if err != nil {
+		return models.Event{}, err
+	}
+	end, err := time.Parse(time.RFC3339, params.EndTime)
+	if err != nil {
+		return models.Event{}, err
+	}
+	if params.TimeZone != "" {
+		loc, err := loadLocation(params.TimeZone)
+		if err != nil {
+			return models.Event{}, fmt.Errorf("params.time_zone %v", err)
+		}
+		start, end = start.In(loc), end.In(loc)
+	}
+	event := models.Event{
+		Summary:     params.Summary,
+		Description: params.Description,
+		Location:    params.Location,
+		Start:       start,
+		End:         end,
+		TimeZone:    params.TimeZone,
+	}
+	for _, email := range params.Attendees {
+		event.Attendees = append(event.Attendees, models.Attendee{Email: email})
+	}
+	return event, nil
+}
+
+func (ec *EventClient) AddEvent(ctx context.Context, outRequest *models.OutRequest, buildSourcePath string) (models.OutResponse, error) {
+	var addEventParams AddEventParams
+	if err := json.Unmarshal(outRequest.Params, &addEventParams); err != nil {
+		return models.OutResponse{}, fmt.Errorf("decoding event params: %v", err)
+	}
+	event, err := addEventParams.Event()
+	if err != nil {
+		return models.OutResponse{}, err
+	}
+	if err := ec.resolveCalendarName(ctx); err != nil {
+		return models.OutResponse{}, err
+	}
+	calendarId := addEventParams.CalendarId
+	if calendarId == "" {
+		calendarId = ec.Source.CalendarId
+	}
+	if calendarId == "" && len(ec.Source.CalendarIds) == 1 {
+		calendarId = ec.Source.CalendarIds[0]
+	}
+	if calendarId == "" {
+		return models.OutResponse{}, fmt.Errorf("params.calendar_id must be set when source.calendar_ids lists several calendars")
+	}
+	added, err := ec.Provider.InsertEvent(ctx, calendarId, event)
+	if err != nil {
+		return models.OutResponse{}, fmt.Errorf("inserting event using calendar client: %v", err)
+	}
+	return models.OutResponse{Version: ec.eventVersion(calendarId, added)}, nil
+}
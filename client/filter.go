@@ -0,0 +1,88 @@
+package client
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/henrytk/calendar-resource/models"
+)
+
+// matches reports whether an event is one the source triggers on: it must
+// be named event_name, or qualify it when qualified_names is set, and pass
+// every filter configured for the source.
+func (ec *EventClient) matches(event models.Event) (bool, error) {
+	named := event.Summary == ec.Source.EventName
+	if ec.Source.QualifiedNames {
+		_, named = summaryQualifier(event.Summary, ec.Source.EventName)
+	}
+	if !named {
+		return false, nil
+	}
+	return ec.matchesFilters(event)
+}
+
+// summaryQualifier reports whether a summary names an event name, either
+// exactly or followed by a colon and a qualifier such as the person on call
+// in "On call: alice". The qualifier is returned without surrounding space.
+func summaryQualifier(summary, name string) (string, bool) {
+	if summary == name {
+		return "", true
+	}
+	if !strings.HasPrefix(summary, name+":") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(summary, name+":")), true
+}
+
+// matchesFilters reports whether an event passes every filter configured for
+// the source, regardless of its name.
+func (ec *EventClient) matchesFilters(event models.Event) (bool, error) {
+	source := ec.Source
+	if len(source.EventTypes) > 0 && !contains(source.EventTypes, event.EventType) {
+		return false, nil
+	}
+	if len(source.Statuses) > 0 && !contains(source.Statuses, event.Status) {
+		return false, nil
+	}
+	if source.Transparency != "" && event.Transparency != source.Transparency {
+		return false, nil
+	}
+	response := event.SelfResponse()
+	if source.SkipDeclined && response == "declined" {
+		return false, nil
+	}
+	switch source.RequireResponse {
+	case "accepted":
+		if response != "accepted" {
+			return false, nil
+		}
+	case "tentative":
+		if response != "accepted" && response != "tentative" {
+			return false, nil
+		}
+	}
+	minDuration, err := parseDuration(source.MinDuration)
+	if err != nil {
+		return false, fmt.Errorf("parsing min_duration: %v", err)
+	}
+	if minDuration > 0 && event.Duration() < minDuration {
+		return false, nil
+	}
+	maxDuration, err := parseDuration(source.MaxDuration)
+	if err != nil {
+		return false, fmt.Errorf("parsing max_duration: %v", err)
+	}
+	if maxDuration > 0 && event.Duration() > maxDuration {
+		return false, nil
+	}
+	return true, nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+// freeBusyLookback is how far back check looks for the busy period which
+// began or ended the current state in freebusy mode.
+const freeBusyLookback = 7 * 24 * time.Hour
+
+// FreeBusyQuerier may be implemented by a Provider to support the freebusy
+// mode.
+type FreeBusyQuerier interface {
+
+	// FreeBusy returns the periods between timeMin and timeMax during which
+	// each calendar is busy, keyed by calendar ID.
+	FreeBusy(ctx context.Context, calendarIds []string, timeMin, timeMax time.Time) (map[string][]models.Period, error)
+}
+
+type byPeriodStart []models.Period
+
+func (p byPeriodStart) Len() int           { return len(p) }
+func (p byPeriodStart) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p byPeriodStart) Less(i, j int) bool { return p[i].Start.Before(p[j].Start) }
+
+// freeBusyVersions emits a version for the current free or busy state of the
+// source's calendars when it is the state the source triggers on. A version
+// is identified by the state and the time the state began: when the last
+// busy period ended, or when the current one began.
+func (ec *EventClient) freeBusyVersions(ctx context.Context, requestedVersion models.Version, now time.Time) ([]models.Version, error) {
+	querier, ok := ec.Provider.(FreeBusyQuerier)
+	if !ok {
+		return nil, fmt.Errorf("querying free/busy: Provider '%v' does not support freebusy mode", ec.Source.Provider)
+	}
+	timeMin := now.Add(-freeBusyLookback)
+	busy, err := querier.FreeBusy(ctx, ec.Source.Calendars(), timeMin, now.Add(time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("querying free/busy using calendar client: %v", err)
+	}
+	var periods []models.Period
+	for _, calendarPeriods := range busy {
+		periods = append(periods, calendarPeriods...)
+	}
+	state, since := TriggerOnFree, timeMin
+	for _, period := range mergePeriods(periods) {
+		switch {
+		case period.Start.After(now):
+		case now.Before(period.End):
+			state, since = TriggerOnBusy, period.Start
+		default:
+			since = period.End
+		}
+	}
+	triggerOn := ec.Source.TriggerOn
+	if triggerOn == "" {
+		triggerOn = TriggerOnFree
+	}
+	if state != triggerOn {
+		return versionsSince(requestedVersion, nil, ec.Source.InitialVersion, now), nil
+	}
+	if !since.After(timeMin) && strings.HasPrefix(requestedVersion.Id, state+"_") {
+		// The state began before the lookback, so its start is unknown and
+		// the requested version is still current.
+		return versionsSince(requestedVersion, nil, ec.Source.InitialVersion, now), nil
+	}
+	version := newVersion(state+"_"+since.UTC().Format(occurrenceIdLayout), since)
+	return versionsSince(requestedVersion, []models.Version{version}, ec.Source.InitialVersion, now), nil
+}
+
+// mergePeriods orders periods by start time and merges those which overlap
+// or abut.
+func mergePeriods(periods []models.Period) []models.Period {
+	sort.Sort(byPeriodStart(periods))
+	var merged []models.Period
+	for _, period := range periods {
+		last := len(merged) - 1
+		if last >= 0 && !period.Start.After(merged[last].End) {
+			if period.End.After(merged[last].End) {
+				merged[last].End = period.End
+			}
+			continue
+		}
+		merged = append(merged, period)
+	}
+	return merged
+}
+
+// freeBusyMetadata describes a freebusy mode version.
+func (ec *EventClient) freeBusyMetadata(version models.Version) []models.KeyValuePair {
+	state := version.Id
+	if separator := strings.Index(state, "_"); separator != -1 {
+		state = state[:separator]
+	}
+	return []models.KeyValuePair{
+		{Name: "state", Value: state},
+		{Name: "since", Value: version.Start},
+		{Name: "calendars", Value: strings.Join(ec.Source.Calendars(), ", ")},
+	}
+}
@@ -4,173 +4,322 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"os"
-	"path/filepath"
+	"net/url"
+	"strings"
 	"time"
 
-	"github.com/henrytk/calendar-resource/errors"
 	"github.com/henrytk/calendar-resource/models"
 	"golang.org/x/net/context"
+	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	googleCalendarAPI "google.golang.org/api/calendar/v3"
+	"google.golang.org/api/googleapi"
 )
 
+func init() {
+	Register("google", NewGoogleCalendarClient)
+	RegisterValidator("google", validateGoogleSource)
+}
+
 type GoogleCalendarClient struct {
 	Source     models.Source
 	HTTPClient *http.Client
 }
 
-func NewGoogleCalendarClient(source models.Source, args ...string) CalendarClient {
-	ctx := context.Background()
-	config, err := google.JWTConfigFromJSON(source.Credentials, args[0])
+// NewGoogleCalendarClient returns a CalendarClient backed by the Google
+// Calendar API.
+func NewGoogleCalendarClient(ctx context.Context, source models.Source, options Options) (CalendarClient, error) {
+	provider, err := NewGoogleProvider(ctx, source, options)
+	if err != nil {
+		return nil, err
+	}
+	return NewEventClient(source, provider), nil
+}
+
+// NewGoogleProvider authenticates with the source's credentials and returns
+// a Provider for Google calendars.
+func NewGoogleProvider(ctx context.Context, source models.Source, options Options) (*GoogleCalendarClient, error) {
+	scope := googleCalendarAPI.CalendarReadonlyScope
+	if options.Access == ReadWrite {
+		scope = googleCalendarAPI.CalendarScope
+	}
+	client, err := googleHTTPClient(ctx, source, scope)
 	if err != nil {
-		errors.Fatal("JWTConfigFromJSON error: ", err)
+		return nil, fmt.Errorf("configuring credentials: %v", err)
 	}
-	client := config.Client(ctx)
+	retryTimeout, err := parseDuration(source.RetryTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("parsing retry_timeout: %v", err)
+	}
+	client.Transport = newRetryTransport(client.Transport, source.RetryAttempts, retryTimeout)
 	return &GoogleCalendarClient{
 		Source:     source,
 		HTTPClient: client,
+	}, nil
+}
+
+// googleHTTPClient returns an HTTP client authorised with the source's
+// service account or authorized_user credentials.
+func googleHTTPClient(ctx context.Context, source models.Source, scope string) (*http.Client, error) {
+	var credentials struct {
+		Type         string `json:"type"`
+		ClientId     string `json:"client_id"`
+		ClientSecret string `json:"client_secret"`
+		RefreshToken string `json:"refresh_token"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(source.Credentials, &credentials); err != nil {
+		return nil, fmt.Errorf("decoding credentials: %v", err)
+	}
+	if credentials.Type != "authorized_user" {
+		config, err := google.JWTConfigFromJSON(source.Credentials, scope)
+		if err != nil {
+			return nil, err
+		}
+		// With domain-wide delegation the service account acts as this user.
+		config.Subject = source.Impersonate
+		return config.Client(ctx), nil
+	}
+	if source.Impersonate != "" {
+		return nil, fmt.Errorf("impersonate requires service account credentials")
+	}
+	endpoint := google.Endpoint
+	if credentials.TokenURI != "" {
+		endpoint.TokenURL = credentials.TokenURI
+	}
+	config := &oauth2.Config{
+		ClientID:     credentials.ClientId,
+		ClientSecret: credentials.ClientSecret,
+		Endpoint:     endpoint,
+		Scopes:       []string{scope},
+	}
+	return config.Client(ctx, &oauth2.Token{RefreshToken: credentials.RefreshToken}), nil
+}
+
+func validateGoogleSource(s models.Source) error {
+	calendarFields := 0
+	for _, set := range []bool{s.CalendarId != "", len(s.CalendarIds) > 0, s.CalendarName != ""} {
+		if set {
+			calendarFields++
+		}
+	}
+	if calendarFields == 0 {
+		return fmt.Errorf("one of source.calendar_id, source.calendar_ids or source.calendar_name must be set for the google provider")
+	}
+	if calendarFields > 1 {
+		return fmt.Errorf("only one of source.calendar_id, source.calendar_ids or source.calendar_name may be set")
+	}
+	for i, calendarId := range s.CalendarIds {
+		if calendarId == "" {
+			return fmt.Errorf("source.calendar_ids[%d] must not be empty", i)
+		}
 	}
+	credentialSources := 0
+	for _, set := range []bool{len(s.Credentials) > 0, s.CredentialsFile != "", s.CredentialsEnv != ""} {
+		if set {
+			credentialSources++
+		}
+	}
+	if credentialSources == 0 {
+		return fmt.Errorf("one of source.credentials, source.credentials_file or source.credentials_env must be set for the google provider")
+	}
+	if credentialSources > 1 {
+		return fmt.Errorf("only one of source.credentials, source.credentials_file or source.credentials_env may be set")
+	}
+	if s.Gate != nil && s.Gate.CalendarId == "" {
+		return fmt.Errorf("source.gate.calendar_id must be set when source.gate is used")
+	}
+	if len(s.Events) > 0 {
+		return fmt.Errorf("source.events is only supported by the local provider")
+	}
+	if s.Endpoint != "" {
+		if u, err := url.Parse(s.Endpoint); err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("source.endpoint must be an absolute URL, got '%v'", s.Endpoint)
+		}
+	}
+	return nil
 }
 
-func (gcc *GoogleCalendarClient) getService() *googleCalendarAPI.Service {
+func (gcc *GoogleCalendarClient) getService() (*googleCalendarAPI.Service, error) {
 	service, err := googleCalendarAPI.New(gcc.HTTPClient)
 	if err != nil {
-		errors.Fatal("Google calendar API error: ", err)
+		return nil, fmt.Errorf("creating Google calendar API service: %v", err)
+	}
+	if gcc.Source.Endpoint != "" {
+		service.BasePath = strings.TrimSuffix(gcc.Source.Endpoint, "/") + "/"
 	}
-	return service
+	return service, nil
+}
+
+// googleEvents is a page of a calendar's events. The vendored Calendar API
+// client predates some event fields, so events are listed with a plain
+// request and decoded here rather than by the client.
+type googleEvents struct {
+	TimeZone      string         `json:"timeZone"`
+	NextPageToken string         `json:"nextPageToken"`
+	Items         []*googleEvent `json:"items"`
 }
 
-func (gcc *GoogleCalendarClient) ListEvents(requestedVersion models.Version) []models.Version {
-	var currentVersions []models.Version
-	service := gcc.getService()
+type googleEvent struct {
+	googleCalendarAPI.Event
+	EventType string `json:"eventType"`
+}
 
-	now := time.Now()
-	formattedTime := now.Format(time.RFC3339)
-	events, err := service.Events.List(gcc.Source.CalendarId).ShowDeleted(false).
-		SingleEvents(true).TimeMin(formattedTime).OrderBy("startTime").Do()
-	if err != nil {
-		errors.Fatal("getting events using calendar client", err)
+func (gcc *GoogleCalendarClient) Events(ctx context.Context, calendarId string, timeMin, timeMax time.Time) ([]models.Event, error) {
+	query := url.Values{
+		"showDeleted":  {"false"},
+		"singleEvents": {"true"},
+		"timeMin":      {timeMin.Format(time.RFC3339Nano)},
+		"timeMax":      {timeMax.Format(time.RFC3339Nano)},
+		"orderBy":      {"startTime"},
 	}
-	if len(events.Items) > 0 {
+	var converted []models.Event
+	for {
+		var events googleEvents
+		if err := gcc.get(ctx, "calendars/"+url.PathEscape(calendarId)+"/events", query, &events); err != nil {
+			return nil, err
+		}
 		for _, item := range events.Items {
-			if item.Summary == gcc.Source.EventName {
-				// If the DateTime is an empty string the Event is an all-day Event.
-				// So only Date is available.
-				var startTime time.Time
-				if item.Start.DateTime != "" {
-					startTime = gcc.parseTime(item.Start.DateTime)
-				} else {
-					startTime = gcc.parseDate(item.Start.Date, events.TimeZone)
-				}
-				if now.After(startTime) {
-					if item.Id == requestedVersion.Id {
-						return []models.Version{models.Version{Id: item.Id}}
-					}
-					currentVersions = append(currentVersions, models.Version{Id: item.Id})
-				}
+			event, err := gcc.toEvent(&item.Event, calendarId, events.TimeZone)
+			if err != nil {
+				return nil, err
+			}
+			if item.EventType != "" {
+				event.EventType = item.EventType
 			}
+			converted = append(converted, event)
+		}
+		if events.NextPageToken == "" {
+			return converted, nil
 		}
+		query.Set("pageToken", events.NextPageToken)
 	}
-	return currentVersions
 }
 
-func (gcc *GoogleCalendarClient) GetEvent(inRequest *models.InRequest, targetDirectory string) (models.InResponse, *os.File, error) {
-	if inRequest.Version.Id == "" {
-		errors.Fatal("fetching resource version", fmt.Errorf("calendar event ID not specified"))
+// get makes a GET request to the Calendar API and decodes the response.
+func (gcc *GoogleCalendarClient) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	service, err := gcc.getService()
+	if err != nil {
+		return err
 	}
-	service := gcc.getService()
-	event, err := service.Events.Get(gcc.Source.CalendarId, inRequest.Version.Id).Do()
+	req, err := http.NewRequest("GET", service.BasePath+path+"?"+query.Encode(), nil)
 	if err != nil {
-		errors.Fatal("getting event using calendar client", err)
+		return err
 	}
-	var start, end string
-	if event.Start.DateTime != "" {
-		start = event.Start.DateTime
-	} else {
-		start = event.Start.Date
+	res, err := gcc.HTTPClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
 	}
-	if event.End.DateTime != "" {
-		end = event.End.DateTime
-	} else {
-		end = event.End.Date
+	defer res.Body.Close()
+	if err := googleapi.CheckResponse(res); err != nil {
+		return err
 	}
-	keyValuePairs := []models.KeyValuePair{
-		models.KeyValuePair{
-			Name:  "time_zone",
-			Value: event.Start.TimeZone,
-		},
-		models.KeyValuePair{
-			Name:  "start",
-			Value: start,
-		},
-		models.KeyValuePair{
-			Name:  "end",
-			Value: end,
-		},
-		models.KeyValuePair{
-			Name:  "created",
-			Value: event.Created,
-		},
-		models.KeyValuePair{
-			Name:  "description",
-			Value: event.Description,
-		},
-		models.KeyValuePair{
-			Name:  "hangoutLink",
-			Value: event.HangoutLink,
-		},
-		models.KeyValuePair{
-			Name:  "htmlLink",
-			Value: event.HtmlLink,
-		},
-		models.KeyValuePair{
-			Name:  "iCalUid",
-			Value: event.ICalUID,
-		},
-		models.KeyValuePair{
-			Name:  "summary",
-			Value: event.Summary,
-		},
-	}
-	inResponse := models.InResponse{
-		Version:  inRequest.Version,
-		MetaData: keyValuePairs,
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Calendars lists the calendars in the account's calendar list, named as
+// the account sees them.
+func (gcc *GoogleCalendarClient) Calendars(ctx context.Context) ([]models.Calendar, error) {
+	service, err := gcc.getService()
+	if err != nil {
+		return nil, err
 	}
+	var calendars []models.Calendar
+	err = service.CalendarList.List().Pages(ctx, func(calendarList *googleCalendarAPI.CalendarList) error {
+		for _, entry := range calendarList.Items {
+			name := entry.SummaryOverride
+			if name == "" {
+				name = entry.Summary
+			}
+			calendars = append(calendars, models.Calendar{Id: entry.Id, Name: name})
+		}
+		return nil
+	})
+	return calendars, err
+}
 
-	file, err := os.Create(filepath.Join(targetDirectory, "input"))
-	defer file.Close()
+// FreeBusy queries the busy periods of calendars, which may be those of
+// people or resources such as meeting rooms.
+func (gcc *GoogleCalendarClient) FreeBusy(ctx context.Context, calendarIds []string, timeMin, timeMax time.Time) (map[string][]models.Period, error) {
+	request := &googleCalendarAPI.FreeBusyRequest{
+		TimeMin: timeMin.Format(time.RFC3339),
+		TimeMax: timeMax.Format(time.RFC3339),
+	}
+	for _, calendarId := range calendarIds {
+		request.Items = append(request.Items, &googleCalendarAPI.FreeBusyRequestItem{Id: calendarId})
+	}
+	service, err := gcc.getService()
 	if err != nil {
-		errors.Fatal("creating input file", err)
+		return nil, err
 	}
-	err = json.NewEncoder(file).Encode(inResponse)
+	response, err := service.Freebusy.Query(request).Context(ctx).Do()
 	if err != nil {
-		errors.Fatal("reading from input request", err)
+		return nil, err
 	}
-	return inResponse, file, nil
+	busy := map[string][]models.Period{}
+	for _, calendarId := range calendarIds {
+		calendar, ok := response.Calendars[calendarId]
+		if !ok {
+			return nil, fmt.Errorf("no free/busy information for calendar '%v'", calendarId)
+		}
+		if len(calendar.Errors) > 0 {
+			return nil, fmt.Errorf("querying free/busy for calendar '%v': %v", calendarId, calendar.Errors[0].Reason)
+		}
+		for _, period := range calendar.Busy {
+			start, err := time.Parse(time.RFC3339, period.Start)
+			if err != nil {
+				return nil, err
+			}
+			end, err := time.Parse(time.RFC3339, period.End)
+			if err != nil {
+				return nil, err
+			}
+			busy[calendarId] = append(busy[calendarId], models.Period{Start: start, End: end})
+		}
+	}
+	return busy, nil
 }
 
-// AddEventParams holds data passed in via `params` from the
-// Conncourse task. StartTime and EndTime must be an RFC3339
-// formatted time string. For example, "2016-10-15T08:00:00+01:00"
-type AddEventParams struct {
-	Description string `json:"description,omitempty"`
-	EndTime     string `json:"end_time"`
-	StartTime   string `json:"start_time"`
-	Summary     string `json:"summary,omitempty"`
-	TimeZone    string `json:"time_zone,omitempty"`
+func (gcc *GoogleCalendarClient) Event(ctx context.Context, calendarId, eventId string) (models.Event, error) {
+	service, err := gcc.getService()
+	if err != nil {
+		return models.Event{}, err
+	}
+	item, err := service.Events.Get(calendarId, eventId).Context(ctx).Do()
+	if err != nil {
+		return models.Event{}, err
+	}
+	calendarTimeZone, err := gcc.calendarTimeZone(ctx, calendarId, item)
+	if err != nil {
+		return models.Event{}, err
+	}
+	return gcc.toEvent(item, calendarId, calendarTimeZone)
 }
 
-func (gcc *GoogleCalendarClient) AddEvent(outRequest *models.OutRequest, buildSourcePath string) models.OutResponse {
-	var addEventParams AddEventParams
-	if err := json.Unmarshal(outRequest.Params, &addEventParams); err != nil {
-		errors.Fatal("decoding event params", err)
+// calendarTimeZone looks up the time zone of a calendar when it is needed to
+// place an event: the event is all-day, has no time zone of its own, and no
+// time zone is configured for the source. Otherwise it returns "".
+func (gcc *GoogleCalendarClient) calendarTimeZone(ctx context.Context, calendarId string, item *googleCalendarAPI.Event) (string, error) {
+	if gcc.Source.TimeZone != "" || item.Start == nil || item.Start.DateTime != "" || item.Start.TimeZone != "" {
+		return "", nil
 	}
-	if addEventParams.StartTime == "" || addEventParams.EndTime == "" {
-		errors.Fatal("adding event", fmt.Errorf("You must supply an event start and end time"))
+	service, err := gcc.getService()
+	if err != nil {
+		return "", err
 	}
-	service := gcc.getService()
-	event := googleCalendarAPI.Event{
+	calendar, err := service.Calendars.Get(calendarId).Context(ctx).Do()
+	if err != nil {
+		return "", err
+	}
+	return calendar.TimeZone, nil
+}
+
+func (gcc *GoogleCalendarClient) InsertEvent(ctx context.Context, calendarId string, event models.Event) (models.Event, error) {
+	service, err := gcc.getService()
+	if err != nil {
+		return models.Event{}, err
+	}
+	item := googleCalendarAPI.Event{
 		// These values are not currently supported by the calendar resource, but
 		// are not optional, so we pass empty literals.
 		Attachments: []*googleCalendarAPI.EventAttachment{},
@@ -179,34 +328,110 @@ func (gcc *GoogleCalendarClient) AddEvent(outRequest *models.OutRequest, buildSo
 
 		// These values can be set by the calendar resource. Only Start and End
 		// are mandatory.
-		Description: addEventParams.Description,
-		End:         &googleCalendarAPI.EventDateTime{TimeZone: addEventParams.TimeZone, DateTime: addEventParams.EndTime},
-		Start:       &googleCalendarAPI.EventDateTime{TimeZone: addEventParams.TimeZone, DateTime: addEventParams.StartTime},
-		Summary:     addEventParams.Summary,
+		Description: event.Description,
+		End:         gcc.fromEventTime(event.End, event.AllDay, event.TimeZone),
+		Location:    event.Location,
+		Start:       gcc.fromEventTime(event.Start, event.AllDay, event.TimeZone),
+		Summary:     event.Summary,
+	}
+	for _, attendee := range event.Attendees {
+		item.Attendees = append(item.Attendees, &googleCalendarAPI.EventAttendee{
+			Email:    attendee.Email,
+			Optional: attendee.Optional,
+		})
 	}
-	e, err := service.Events.Insert(outRequest.Source.CalendarId, &event).Do()
+	inserted, err := service.Events.Insert(calendarId, &item).Context(ctx).Do()
 	if err != nil {
-		errors.Fatal("adding event", err)
+		return models.Event{}, err
 	}
-	return models.OutResponse{Version: models.Version{Id: e.Id}}
+	calendarTimeZone, err := gcc.calendarTimeZone(ctx, calendarId, inserted)
+	if err != nil {
+		return models.Event{}, err
+	}
+	return gcc.toEvent(inserted, calendarId, calendarTimeZone)
 }
 
-func (gcc *GoogleCalendarClient) parseTime(timeString string) time.Time {
-	t, err := time.Parse(time.RFC3339, timeString)
-	if err != nil {
-		errors.Fatal("parsing time: ", err)
+// toEvent converts a Google event to a models.Event. Event times are placed
+// in the source's time_zone if it is set, otherwise in the event's own time
+// zone, then the calendar's, falling back to UTC when none is known. This
+// decides the instant at which an all-day event starts and ends.
+func (gcc *GoogleCalendarClient) toEvent(item *googleCalendarAPI.Event, calendarId, calendarTimeZone string) (models.Event, error) {
+	event := models.Event{
+		Id:          item.Id,
+		CalendarId:  calendarId,
+		Summary:     item.Summary,
+		Description: item.Description,
+		Location:    item.Location,
+		Status:      item.Status,
+		EventType:   "default",
+		Recurrence:  item.Recurrence,
+		Properties: map[string]string{
+			"hangoutLink": item.HangoutLink,
+			"htmlLink":    item.HtmlLink,
+			"iCalUid":     item.ICalUID,
+		},
+	}
+	if item.Start == nil || item.End == nil {
+		return event, fmt.Errorf("event '%v' has no start or end time", item.Id)
+	}
+	timeZone := gcc.Source.TimeZone
+	if timeZone == "" {
+		timeZone = item.Start.TimeZone
 	}
-	return t
+	if timeZone == "" {
+		timeZone = calendarTimeZone
+	}
+	event.TimeZone = timeZone
+	var err error
+	// If the DateTime is an empty string the Event is an all-day Event.
+	// So only Date is available.
+	event.AllDay = item.Start.DateTime == ""
+	if event.Start, err = gcc.parseEventTime(item.Start, timeZone); err != nil {
+		return event, err
+	}
+	if event.End, err = gcc.parseEventTime(item.End, timeZone); err != nil {
+		return event, err
+	}
+	event.Transparency = "busy"
+	if item.Transparency == "transparent" {
+		event.Transparency = "free"
+	}
+	event.Created, _ = time.Parse(time.RFC3339, item.Created)
+	event.Updated, _ = time.Parse(time.RFC3339, item.Updated)
+	for _, attendee := range item.Attendees {
+		event.Attendees = append(event.Attendees, models.Attendee{
+			Email:          attendee.Email,
+			DisplayName:    attendee.DisplayName,
+			ResponseStatus: attendee.ResponseStatus,
+			Optional:       attendee.Optional,
+			Resource:       attendee.Resource,
+			Self:           attendee.Self,
+		})
+	}
+	return event, nil
 }
 
-func (gcc *GoogleCalendarClient) parseDate(date, location string) time.Time {
-	loc, err := time.LoadLocation(location)
-	if err != nil {
-		errors.Fatal("parsing time: ", err)
+func (gcc *GoogleCalendarClient) parseEventTime(eventDateTime *googleCalendarAPI.EventDateTime, timeZone string) (time.Time, error) {
+	loc := time.UTC
+	if timeZone != "" {
+		var err error
+		if loc, err = loadLocation(timeZone); err != nil {
+			return time.Time{}, err
+		}
 	}
-	t, err := time.ParseInLocation("2006-01-02", date, loc)
-	if err != nil {
-		errors.Fatal("parsing date: ", err)
+	if eventDateTime.DateTime != "" {
+		t, err := time.Parse(time.RFC3339, eventDateTime.DateTime)
+		if err != nil {
+			return time.Time{}, err
+		}
+		return t.In(loc), nil
+	}
+	return time.ParseInLocation(dateLayout, eventDateTime.Date, loc)
+}
+
+func (gcc *GoogleCalendarClient) fromEventTime(t time.Time, allDay bool, timeZone string) *googleCalendarAPI.EventDateTime {
+	if allDay {
+		return &googleCalendarAPI.EventDateTime{TimeZone: timeZone, Date: t.Format(dateLayout)}
 	}
-	return t
+	return &googleCalendarAPI.EventDateTime{TimeZone: timeZone, DateTime: t.Format(time.RFC3339)}
 }
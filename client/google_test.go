@@ -0,0 +1,860 @@
+package client
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrytk/calendar-resource/client/googlefake"
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+	googleCalendarAPI "google.golang.org/api/calendar/v3"
+)
+
+const testCalendarId = "team@example.com"
+
+func newTestGoogleClient(t *testing.T, server *googlefake.Server, source models.Source) CalendarClient {
+	source.Provider = "google"
+	if len(source.CalendarIds) == 0 && source.CalendarName == "" {
+		source.CalendarId = testCalendarId
+	}
+	source.Endpoint = server.URL
+	source.Credentials = server.Credentials()
+	calendarClient, err := NewGoogleCalendarClient(context.Background(), source, Options{Access: ReadWrite})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return calendarClient
+}
+
+// listTestVersions lists the client's versions, failing the test on error.
+func listTestVersions(t *testing.T, calendarClient CalendarClient, requestedVersion models.Version) []models.Version {
+	versions, err := calendarClient.ListEvents(context.Background(), requestedVersion)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return versions
+}
+
+func addTestEvent(server *googlefake.Server, calendarId, summary string, start, end time.Time) *googleCalendarAPI.Event {
+	return server.AddEvent(calendarId, &googleCalendarAPI.Event{
+		Summary: summary,
+		Start:   &googleCalendarAPI.EventDateTime{DateTime: start.Format(time.RFC3339)},
+		End:     &googleCalendarAPI.EventDateTime{DateTime: end.Format(time.RFC3339)},
+	})
+}
+
+func versionIds(versions []models.Version) []string {
+	ids := []string{}
+	for _, version := range versions {
+		ids = append(ids, version.Id)
+	}
+	return ids
+}
+
+func TestGoogleListEventsOrdersVersionsByStartTime(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	later := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+	earlier := addTestEvent(server, testCalendarId, "Deploy", now.Add(-2*time.Hour), now.Add(time.Hour))
+	addTestEvent(server, testCalendarId, "Lunch", now.Add(-time.Hour), now.Add(time.Hour))
+	addTestEvent(server, testCalendarId, "Deploy", now.Add(time.Hour), now.Add(2*time.Hour))
+	addTestEvent(server, testCalendarId, "Deploy", now.Add(-3*time.Hour), now.Add(-2*time.Hour))
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy"})
+	versions := listTestVersions(t, calendarClient, models.Version{})
+
+	expected := []string{earlier.Id, later.Id}
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected versions %v, got %v", expected, ids)
+	}
+	expectedStart := now.Add(-2 * time.Hour).UTC().Format(time.RFC3339)
+	if versions[0].Start != expectedStart {
+		t.Errorf("expected start %v, got %v", expectedStart, versions[0].Start)
+	}
+}
+
+func TestGoogleListEventsReturnsRequestedAndNewerVersions(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	first := addTestEvent(server, testCalendarId, "Deploy", now.Add(-3*time.Hour), now.Add(time.Hour))
+	second := addTestEvent(server, testCalendarId, "Deploy", now.Add(-2*time.Hour), now.Add(time.Hour))
+	third := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy"})
+	requested := newVersion(second.Id, now.Add(-2*time.Hour))
+	versions := listTestVersions(t, calendarClient, requested)
+
+	expected := []string{second.Id, third.Id}
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected versions %v, got %v", expected, ids)
+	}
+
+	// A requested version which has since ended is still returned first.
+	ended := newVersion("ended", now.Add(-4*time.Hour))
+	versions = listTestVersions(t, calendarClient, ended)
+	expected = []string{"ended", first.Id, second.Id, third.Id}
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected versions %v, got %v", expected, ids)
+	}
+}
+
+func TestGoogleListEventsInitialVersion(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	first := addTestEvent(server, testCalendarId, "Deploy", now.Add(-2*time.Hour), now.Add(time.Hour))
+	second := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+
+	for _, test := range []struct {
+		initialVersion string
+		expected       []string
+	}{
+		{"", []string{first.Id, second.Id}},
+		{InitialVersionAll, []string{first.Id, second.Id}},
+		{InitialVersionLatest, []string{second.Id}},
+		{InitialVersionNone, []string{initialMarkerId}},
+	} {
+		calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy", InitialVersion: test.initialVersion})
+		versions := listTestVersions(t, calendarClient, models.Version{})
+		if ids := versionIds(versions); !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("initial_version '%v': expected versions %v, got %v", test.initialVersion, test.expected, ids)
+			continue
+		}
+
+		// Concourse saves the latest version and requests it next time,
+		// which then finds nothing newer.
+		latest := versions[len(versions)-1]
+		versions = listTestVersions(t, calendarClient, latest)
+		if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{latest.Id}) {
+			t.Errorf("initial_version '%v': expected the second check to return only %v, got %v", test.initialVersion, latest.Id, ids)
+		}
+	}
+
+	// Events starting after the first check compare as newer than its marker.
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy", InitialVersion: InitialVersionNone})
+	marker := newVersion(initialMarkerId, now.Add(-90*time.Minute))
+	versions := listTestVersions(t, calendarClient, marker)
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{initialMarkerId, second.Id}) {
+		t.Errorf("expected versions %v, got %v", []string{initialMarkerId, second.Id}, ids)
+	}
+}
+
+func TestGoogleListEventsQualifiedNames(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	deploy := addTestEvent(server, testCalendarId, "Deploy", now.Add(-2*time.Hour), now.Add(time.Hour))
+	qualified := addTestEvent(server, testCalendarId, "Deploy: cancelled", now.Add(-time.Hour), now.Add(time.Hour))
+	addTestEvent(server, testCalendarId, "Deployment", now.Add(-time.Hour), now.Add(time.Hour))
+
+	for _, test := range []struct {
+		qualifiedNames bool
+		expected       []string
+	}{
+		{false, []string{deploy.Id}},
+		{true, []string{deploy.Id, qualified.Id}},
+	} {
+		calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy", QualifiedNames: test.qualifiedNames})
+		versions := listTestVersions(t, calendarClient, models.Version{})
+		if ids := versionIds(versions); !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("qualified_names %v: expected versions %v, got %v", test.qualifiedNames, test.expected, ids)
+		}
+	}
+}
+
+func TestGoogleGetInitialMarker(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	targetDirectory, err := ioutil.TempDir("", "calendar-resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetDirectory)
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy", InitialVersion: InitialVersionNone})
+	marker := newVersion(initialMarkerId, time.Now())
+	inResponse, _, err := calendarClient.GetEvent(context.Background(), &models.InRequest{Version: marker}, targetDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inResponse.Version != marker || len(inResponse.MetaData) != 0 {
+		t.Errorf("expected the marker to be returned without metadata, got %+v", inResponse)
+	}
+}
+
+func TestGoogleListEventsSuppressedByGate(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+	addTestEvent(server, "freeze@example.com", "Party", now.Add(-time.Hour), now.Add(time.Hour))
+	addTestEvent(server, "freeze@example.com", "Change freeze", now.Add(time.Hour), now.Add(2*time.Hour))
+
+	source := models.Source{
+		EventName: "Deploy",
+		Gate:      &models.Gate{CalendarId: "freeze@example.com", EventName: "Change freeze"},
+	}
+	calendarClient := newTestGoogleClient(t, server, source)
+	if versions := listTestVersions(t, calendarClient, models.Version{}); len(versions) != 1 {
+		t.Fatalf("expected a version while no freeze is active, got %v", versions)
+	}
+
+	addTestEvent(server, "freeze@example.com", "Change freeze", now.Add(-time.Minute), now.Add(time.Hour))
+	if versions := listTestVersions(t, calendarClient, models.Version{}); len(versions) != 0 {
+		t.Fatalf("expected no versions during a freeze, got %v", versions)
+	}
+}
+
+func TestGoogleListEventsAfterFreezeEnds(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	during := addTestEvent(server, testCalendarId, "Deploy", now.Add(-3*time.Hour), now.Add(time.Hour))
+	after := addTestEvent(server, testCalendarId, "Deploy", now.Add(-30*time.Minute), now.Add(time.Hour))
+	addTestEvent(server, "freeze@example.com", "Change freeze", now.Add(-4*time.Hour), now.Add(-time.Hour))
+
+	for _, test := range []struct {
+		discardBlocked bool
+		expected       []string
+	}{
+		{false, []string{during.Id, after.Id}},
+		{true, []string{after.Id}},
+	} {
+		source := models.Source{
+			EventName: "Deploy",
+			Gate:      &models.Gate{CalendarId: "freeze@example.com", DiscardBlocked: test.discardBlocked},
+		}
+		versions := listTestVersions(t, newTestGoogleClient(t, server, source), models.Version{})
+		if ids := versionIds(versions); !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("discard_blocked %v: expected versions %v, got %v", test.discardBlocked, test.expected, ids)
+		}
+	}
+}
+
+func TestGoogleGetEventWritesInputFile(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now().Truncate(time.Second)
+	event := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+
+	targetDirectory, err := ioutil.TempDir("", "calendar-resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetDirectory)
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy"})
+	inRequest := &models.InRequest{Version: models.Version{Id: event.Id}}
+	inResponse, _, err := calendarClient.GetEvent(context.Background(), inRequest, targetDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inResponse.Version.Id != event.Id {
+		t.Errorf("expected version %v, got %v", event.Id, inResponse.Version.Id)
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(targetDirectory, "input"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written models.InResponse
+	if err := json.Unmarshal(contents, &written); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(written, inResponse) {
+		t.Errorf("expected input file to contain %v, got %v", inResponse, written)
+	}
+	metadata := map[string]string{}
+	for _, pair := range written.MetaData {
+		metadata[pair.Name] = pair.Value
+	}
+	if metadata["summary"] != "Deploy" || metadata["start"] != event.Start.DateTime {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+}
+
+func TestGoogleAddEvent(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy"})
+	outRequest := &models.OutRequest{
+		Source: models.Source{CalendarId: testCalendarId},
+		Params: json.RawMessage(`{
+			"summary": "Release",
+			"start_time": "2016-10-24T13:00:00+01:00",
+			"end_time": "2016-10-24T14:00:00+01:00",
+			"time_zone": "Europe/London"
+		}`),
+	}
+	outResponse, err := calendarClient.AddEvent(context.Background(), outRequest, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := server.Events(testCalendarId)
+	if len(events) != 1 {
+		t.Fatalf("expected one event to be added, got %v", len(events))
+	}
+	if events[0].Summary != "Release" || events[0].Start.TimeZone != "Europe/London" {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+	expected := models.Version{Id: events[0].Id, Start: "2016-10-24T12:00:00Z"}
+	if outResponse.Version != expected {
+		t.Errorf("expected version %v, got %v", expected, outResponse.Version)
+	}
+}
+
+func TestGoogleRetriesTransientFailures(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+	server.FailNext(http.StatusServiceUnavailable, http.StatusTooManyRequests)
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy", RetryAttempts: 3, RetryTimeout: "10s"})
+	versions := listTestVersions(t, calendarClient, models.Version{})
+	if len(versions) != 1 {
+		t.Fatalf("expected one version after retrying, got %v", versions)
+	}
+	if requests := server.Requests(); requests != 3 {
+		t.Errorf("expected 3 requests, got %v", requests)
+	}
+}
+
+func TestGoogleListEventsMergesCalendars(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	europe := addTestEvent(server, "europe@example.com", "On call", now.Add(-2*time.Hour), now.Add(time.Hour))
+	america := addTestEvent(server, "america@example.com", "On call", now.Add(-time.Hour), now.Add(time.Hour))
+
+	source := models.Source{EventName: "On call", CalendarIds: []string{"europe@example.com", "america@example.com"}}
+	calendarClient := newTestGoogleClient(t, server, source)
+	versions := listTestVersions(t, calendarClient, models.Version{})
+
+	expected := []models.Version{
+		newVersion(europe.Id, now.Add(-2*time.Hour)),
+		newVersion(america.Id, now.Add(-time.Hour)),
+	}
+	expected[0].CalendarId = "europe@example.com"
+	expected[1].CalendarId = "america@example.com"
+	if !reflect.DeepEqual(versions, expected) {
+		t.Fatalf("expected versions %v, got %v", expected, versions)
+	}
+
+	targetDirectory, err := ioutil.TempDir("", "calendar-resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetDirectory)
+	inResponse, _, err := calendarClient.GetEvent(context.Background(), &models.InRequest{Version: versions[1]}, targetDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inResponse.Version != versions[1] {
+		t.Errorf("expected version %v, got %v", versions[1], inResponse.Version)
+	}
+}
+
+func TestGoogleResolvesCalendarName(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	server.AddCalendar("abc123@group.calendar.google.com", "Releases")
+	server.AddCalendar("def456@group.calendar.google.com", "Freezes")
+	now := time.Now()
+	event := addTestEvent(server, "abc123@group.calendar.google.com", "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy", CalendarName: "Releases"})
+	versions := listTestVersions(t, calendarClient, models.Version{})
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{event.Id}) {
+		t.Fatalf("expected versions [%v], got %v", event.Id, ids)
+	}
+}
+
+func TestGoogleListEventsFilters(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	meeting := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+	away := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+	server.SetEventType(away.Id, "outOfOffice")
+	tentative := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Minute), now.Add(time.Minute))
+	tentative.Status = "tentative"
+	free := addTestEvent(server, testCalendarId, "Deploy", now.Add(-2*time.Hour), now.Add(3*time.Hour))
+	free.Transparency = "transparent"
+
+	for _, test := range []struct {
+		source   models.Source
+		expected []string
+	}{
+		{models.Source{}, []string{free.Id, meeting.Id, away.Id, tentative.Id}},
+		{models.Source{EventTypes: []string{"outOfOffice"}}, []string{away.Id}},
+		{models.Source{Statuses: []string{"tentative"}}, []string{tentative.Id}},
+		{models.Source{Transparency: "free"}, []string{free.Id}},
+		{models.Source{Transparency: "busy", MinDuration: "1h"}, []string{meeting.Id, away.Id}},
+		{models.Source{MaxDuration: "1h"}, []string{tentative.Id}},
+	} {
+		test.source.EventName = "Deploy"
+		calendarClient := newTestGoogleClient(t, server, test.source)
+		versions := listTestVersions(t, calendarClient, models.Version{})
+		if ids := versionIds(versions); !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("source %+v: expected versions %v, got %v", test.source, test.expected, ids)
+		}
+	}
+}
+
+func TestGoogleListEventsRespectsOwnerResponse(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	responses := map[string]string{}
+	for i, response := range []string{"accepted", "tentative", "declined", "needsAction", ""} {
+		event := addTestEvent(server, testCalendarId, "Standup", now.Add(-time.Duration(i+1)*time.Minute), now.Add(time.Hour))
+		if response != "" {
+			event.Attendees = []*googleCalendarAPI.EventAttendee{
+				{Email: "organiser@example.com", ResponseStatus: "accepted"},
+				{Email: testCalendarId, ResponseStatus: response, Self: true},
+			}
+		}
+		responses[response] = event.Id
+	}
+
+	for _, test := range []struct {
+		source   models.Source
+		expected []string
+	}{
+		{models.Source{SkipDeclined: true}, []string{responses[""], responses["needsAction"], responses["tentative"], responses["accepted"]}},
+		{models.Source{RequireResponse: "tentative"}, []string{responses[""], responses["tentative"], responses["accepted"]}},
+		{models.Source{RequireResponse: "accepted"}, []string{responses[""], responses["accepted"]}},
+	} {
+		test.source.EventName = "Standup"
+		calendarClient := newTestGoogleClient(t, server, test.source)
+		versions := listTestVersions(t, calendarClient, models.Version{})
+		if ids := versionIds(versions); !reflect.DeepEqual(ids, test.expected) {
+			t.Errorf("source %+v: expected versions %v, got %v", test.source, test.expected, ids)
+		}
+	}
+}
+
+func TestGoogleListEventsTriggersOnChanges(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	booked := func(summary string, start time.Time, created time.Time) *googleCalendarAPI.Event {
+		event := addTestEvent(server, testCalendarId, summary, start, start.Add(time.Hour))
+		event.Created = created.UTC().Format(time.RFC3339)
+		event.Updated = event.Created
+		return event
+	}
+	later := booked("Release", now.Add(48*time.Hour), now.Add(-2*time.Hour))
+	sooner := booked("Release", now.Add(24*time.Hour), now.Add(-time.Hour))
+	booked("Release", now.Add(-2*time.Hour), now.Add(-3*time.Hour))
+	booked("Lunch", now.Add(time.Hour), now.Add(-time.Hour))
+
+	created := newTestGoogleClient(t, server, models.Source{EventName: "Release", TriggerOn: TriggerOnCreated})
+	versions := listTestVersions(t, created, models.Version{})
+	expected := []string{later.Id, sooner.Id}
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, expected) {
+		t.Fatalf("expected versions ordered by creation %v, got %v", expected, ids)
+	}
+	if versions[0].Changed != later.Created {
+		t.Errorf("expected changed %v, got %v", later.Created, versions[0].Changed)
+	}
+
+	updated := newTestGoogleClient(t, server, models.Source{EventName: "Release", TriggerOn: TriggerOnUpdated})
+	requested := listTestVersions(t, updated, models.Version{})[1]
+	later.Updated = now.UTC().Format(time.RFC3339)
+	versions = listTestVersions(t, updated, requested)
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{sooner.Id, later.Id}) {
+		t.Fatalf("expected the edited event after the requested version, got %v", ids)
+	}
+	if versions[1].Changed != later.Updated {
+		t.Errorf("expected changed %v, got %v", later.Updated, versions[1].Changed)
+	}
+}
+
+func TestGoogleGetEventRequiresAcceptance(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	event := addTestEvent(server, testCalendarId, "Change advisory board", now.Add(-time.Hour), now.Add(time.Hour))
+	event.Attendees = []*googleCalendarAPI.EventAttendee{
+		{Email: "alice@example.com", ResponseStatus: "accepted"},
+		{Email: "bob@example.com", ResponseStatus: "declined"},
+		{Email: "carol@example.com", ResponseStatus: "accepted"},
+		{Email: "room@example.com", ResponseStatus: "accepted", Resource: true},
+	}
+
+	targetDirectory, err := ioutil.TempDir("", "calendar-resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetDirectory)
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Change advisory board"})
+	for _, test := range []struct {
+		params      string
+		expectedErr string
+	}{
+		{`{"require_accepted_by": ["Alice@example.com", "carol@example.com"]}`, ""},
+		{`{"require_accepted_by": "bob@example.com"}`, "has not been accepted by bob@example.com"},
+		{`{"require_accepted_by": 2}`, ""},
+		{`{"require_accepted_by": 3}`, "accepted by 2 attendees, but 3 are required"},
+	} {
+		inRequest := &models.InRequest{Version: models.Version{Id: event.Id}, Params: json.RawMessage(test.params)}
+		_, _, err := calendarClient.GetEvent(context.Background(), inRequest, targetDirectory)
+		if test.expectedErr == "" && err != nil {
+			t.Errorf("params %v: unexpected error %v", test.params, err)
+		}
+		if test.expectedErr != "" && (err == nil || !strings.Contains(err.Error(), test.expectedErr)) {
+			t.Errorf("params %v: expected error containing %q, got %v", test.params, test.expectedErr, err)
+		}
+	}
+}
+
+func TestGoogleFreeBusyMode(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now().Truncate(time.Second)
+	addTestEvent(server, "alice@example.com", "Planning", now.Add(-2*time.Hour), now.Add(-30*time.Minute))
+	addTestEvent(server, "bob@example.com", "Interview", now.Add(-time.Hour), now.Add(-10*time.Minute))
+	addTestEvent(server, "bob@example.com", "Lunch", now.Add(-20*time.Minute), now.Add(-15*time.Minute))
+	source := models.Source{
+		Mode:        ModeFreeBusy,
+		CalendarIds: []string{"alice@example.com", "bob@example.com"},
+	}
+
+	free := newTestGoogleClient(t, server, source)
+	versions := listTestVersions(t, free, models.Version{})
+	expected := []models.Version{newVersion("free_"+now.Add(-10*time.Minute).UTC().Format(occurrenceIdLayout), now.Add(-10*time.Minute))}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Fatalf("expected versions %v, got %v", expected, versions)
+	}
+	source.TriggerOn = TriggerOnBusy
+	if versions := listTestVersions(t, newTestGoogleClient(t, server, source), models.Version{}); len(versions) != 0 {
+		t.Errorf("expected no versions while everyone is free, got %v", versions)
+	}
+
+	addTestEvent(server, "alice@example.com", "Incident", now.Add(-5*time.Minute), now.Add(time.Hour))
+	busy := newTestGoogleClient(t, server, source)
+	versions = listTestVersions(t, busy, expected[0])
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{expected[0].Id, "busy_" + now.Add(-5*time.Minute).UTC().Format(occurrenceIdLayout)}) {
+		t.Fatalf("expected a busy version after the free one, got %v", ids)
+	}
+
+	targetDirectory, err := ioutil.TempDir("", "calendar-resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetDirectory)
+	inResponse, _, err := busy.GetEvent(context.Background(), &models.InRequest{Version: versions[1]}, targetDirectory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedMetadata := []models.KeyValuePair{
+		{Name: "state", Value: "busy"},
+		{Name: "since", Value: versions[1].Start},
+		{Name: "calendars", Value: "alice@example.com, bob@example.com"},
+	}
+	if !reflect.DeepEqual(inResponse.MetaData, expectedMetadata) {
+		t.Errorf("expected metadata %v, got %v", expectedMetadata, inResponse.MetaData)
+	}
+}
+
+func TestGoogleGetEventWritesOnCall(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now().UTC().Truncate(time.Second)
+	current := addTestEvent(server, testCalendarId, "On call: alice", now.Add(-time.Hour), now.Add(2*time.Hour))
+	next := addTestEvent(server, testCalendarId, "On call: bob", now.Add(2*time.Hour), now.Add(10*time.Hour))
+	secondary := addTestEvent(server, testCalendarId, "On call", now.Add(2*time.Hour), now.Add(10*time.Hour))
+	secondary.Attendees = []*googleCalendarAPI.EventAttendee{
+		{Email: "carol@example.com", DisplayName: "Carol", ResponseStatus: "accepted"},
+		{Email: "room@example.com", Resource: true},
+	}
+	addTestEvent(server, testCalendarId, "On call: dave", now.Add(10*time.Hour), now.Add(20*time.Hour))
+	addTestEvent(server, testCalendarId, "On calling", now.Add(-time.Hour), now.Add(time.Hour))
+
+	targetDirectory, err := ioutil.TempDir("", "calendar-resource")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(targetDirectory)
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "On call", QualifiedNames: true})
+	versions := listTestVersions(t, calendarClient, models.Version{})
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{current.Id}) {
+		t.Fatalf("expected check to emit the current shift, got %v", ids)
+	}
+	inRequest := &models.InRequest{Version: versions[0], Params: json.RawMessage(`{"on_call": true}`)}
+	if _, _, err := calendarClient.GetEvent(context.Background(), inRequest, targetDirectory); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(targetDirectory, "on_call.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var onCall OnCall
+	if err := json.Unmarshal(contents, &onCall); err != nil {
+		t.Fatal(err)
+	}
+	handover := now.Add(2 * time.Hour).Format(time.RFC3339)
+	end := now.Add(10 * time.Hour).Format(time.RFC3339)
+	expected := OnCall{
+		Now: []OnCallShift{
+			{Name: "alice", Start: now.Add(-time.Hour).Format(time.RFC3339), End: handover, EventId: current.Id},
+		},
+		Next: []OnCallShift{
+			{Name: "Carol", Email: "carol@example.com", Start: handover, End: end, EventId: secondary.Id},
+			{Name: "bob", Start: handover, End: end, EventId: next.Id},
+		},
+		Handover: handover,
+	}
+	if !reflect.DeepEqual(onCall, expected) {
+		t.Errorf("expected on call %+v, got %+v", expected, onCall)
+	}
+}
+
+func TestGoogleOnCallOrdersShiftsAcrossOffsets(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now().UTC().Truncate(time.Second)
+	// In a time zone ahead of UTC, alice's start sorts after bob's as text.
+	alice := addTestEvent(server, testCalendarId, "On call: alice", now.Add(-2*time.Hour), now.Add(time.Hour))
+	alice.Start.TimeZone = "Asia/Tokyo"
+	addTestEvent(server, testCalendarId, "On call: bob", now.Add(-time.Hour), now.Add(time.Hour))
+	addTestEvent(server, testCalendarId, "On call: carol", now.Add(time.Hour), now.Add(2*time.Hour))
+
+	for _, timeZone := range []string{"", "America/New_York"} {
+		loc := time.UTC
+		if timeZone != "" {
+			var err error
+			if loc, err = loadLocation(timeZone); err != nil {
+				t.Fatal(err)
+			}
+		}
+		calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "On call", TimeZone: timeZone}).(*EventClient)
+		onCall, err := calendarClient.onCall(context.Background(), OnCallParams{}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names, starts []string
+		for _, shift := range onCall.Now {
+			names = append(names, shift.Name)
+			starts = append(starts, shift.Start)
+		}
+		expectedStarts := []string{now.Add(-2 * time.Hour).In(loc).Format(time.RFC3339), now.Add(-time.Hour).In(loc).Format(time.RFC3339)}
+		if !reflect.DeepEqual(names, []string{"alice", "bob"}) || !reflect.DeepEqual(starts, expectedStarts) {
+			t.Errorf("time_zone '%v': expected alice then bob starting %v, got %v starting %v", timeZone, expectedStarts, names, starts)
+		}
+		if handover := now.Add(time.Hour).In(loc).Format(time.RFC3339); onCall.Handover != handover {
+			t.Errorf("time_zone '%v': expected handover %v, got %v", timeZone, handover, onCall.Handover)
+		}
+	}
+}
+
+func TestGoogleListEventsLookback(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	addTestEvent(server, testCalendarId, "Deploy", now.Add(-30*time.Hour), now.Add(-26*time.Hour))
+	missed := addTestEvent(server, testCalendarId, "Deploy", now.Add(-10*time.Hour), now.Add(-9*time.Hour))
+	alsoMissed := addTestEvent(server, testCalendarId, "Deploy", now.Add(-5*time.Hour), now.Add(-4*time.Hour))
+	current := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Minute), now.Add(time.Hour))
+	addTestEvent(server, testCalendarId, "Deploy", now.Add(time.Hour), now.Add(2*time.Hour))
+
+	calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy", Lookback: "24h"})
+	requested := newVersion(missed.Id, now.Add(-10*time.Hour))
+	versions := listTestVersions(t, calendarClient, requested)
+	expected := []string{missed.Id, alsoMissed.Id, current.Id}
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected versions %v, got %v", expected, ids)
+	}
+}
+
+func TestGoogleListEventsCoalescesAdjacentEvents(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	earlier := addTestEvent(server, testCalendarId, "Deploy window", now.Add(-6*time.Hour), now.Add(-5*time.Hour))
+	first := addTestEvent(server, testCalendarId, "Deploy window", now.Add(-2*time.Hour), now.Add(-time.Hour))
+	addTestEvent(server, testCalendarId, "Deploy window", now.Add(-time.Hour), now)
+	addTestEvent(server, testCalendarId, "Deploy window", now.Add(10*time.Minute), now.Add(time.Hour))
+
+	source := models.Source{EventName: "Deploy window", CoalesceGap: "15m"}
+	versions := listTestVersions(t, newTestGoogleClient(t, server, source), models.Version{})
+	expected := []models.Version{newVersion(first.Id, now.Add(-2*time.Hour))}
+	if !reflect.DeepEqual(versions, expected) {
+		t.Errorf("expected versions %v, got %v", expected, versions)
+	}
+
+	source.Lookback = "8h"
+	versions = listTestVersions(t, newTestGoogleClient(t, server, source), models.Version{})
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{earlier.Id, first.Id}) {
+		t.Errorf("expected separate windows to emit separate versions, got %v", ids)
+	}
+}
+
+func TestGoogleListEventsMinInterval(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	first := addTestEvent(server, testCalendarId, "Deploy", now.Add(-3*time.Hour), now.Add(-2*time.Hour))
+	addTestEvent(server, testCalendarId, "Deploy", now.Add(-170*time.Minute), now.Add(-160*time.Minute))
+	last := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+
+	source := models.Source{EventName: "Deploy", Lookback: "4h", MinInterval: "1h"}
+	versions := listTestVersions(t, newTestGoogleClient(t, server, source), models.Version{})
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{first.Id, last.Id}) {
+		t.Errorf("expected one version per hour, got %v", ids)
+	}
+}
+
+func TestGoogleListEventsLookbackRespectsGate(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	addTestEvent(server, testCalendarId, "Deploy", now.Add(-3*time.Hour), now.Add(-150*time.Minute))
+	missed := addTestEvent(server, testCalendarId, "Deploy", now.Add(-50*time.Minute), now.Add(-40*time.Minute))
+	addTestEvent(server, "freeze@example.com", "Change freeze", now.Add(-4*time.Hour), now.Add(-time.Hour))
+
+	source := models.Source{
+		EventName: "Deploy",
+		Lookback:  "24h",
+		Gate:      &models.Gate{CalendarId: "freeze@example.com", DiscardBlocked: true},
+	}
+	versions := listTestVersions(t, newTestGoogleClient(t, server, source), models.Version{})
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{missed.Id}) {
+		t.Errorf("expected events during the freeze not to be replayed, got %v", ids)
+	}
+}
+
+func TestGoogleServiceAccountImpersonation(t *testing.T) {
+	for _, impersonate := range []string{"", "alice@example.com"} {
+		server := googlefake.NewServer()
+		now := time.Now()
+		addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+
+		calendarClient := newTestGoogleClient(t, server, models.Source{EventName: "Deploy", Impersonate: impersonate})
+		listTestVersions(t, calendarClient, models.Version{})
+		if subjects := server.Subjects(); !reflect.DeepEqual(subjects, []string{impersonate}) {
+			t.Errorf("impersonate '%v': expected tokens to be requested for subjects %q, got %q", impersonate, []string{impersonate}, subjects)
+		}
+		server.Close()
+	}
+}
+
+func TestGoogleAuthorizedUserCredentials(t *testing.T) {
+	server := googlefake.NewServer()
+	defer server.Close()
+	now := time.Now()
+	event := addTestEvent(server, testCalendarId, "Deploy", now.Add(-time.Hour), now.Add(time.Hour))
+
+	source := models.Source{
+		Provider:    "google",
+		CalendarId:  testCalendarId,
+		EventName:   "Deploy",
+		Endpoint:    server.URL,
+		Credentials: server.AuthorizedUserCredentials(),
+	}
+	calendarClient, err := NewGoogleCalendarClient(context.Background(), source, Options{Access: ReadOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	versions := listTestVersions(t, calendarClient, models.Version{})
+	if ids := versionIds(versions); !reflect.DeepEqual(ids, []string{event.Id}) {
+		t.Errorf("expected versions [%v], got %v", event.Id, ids)
+	}
+
+	var revoked map[string]string
+	json.Unmarshal(server.AuthorizedUserCredentials(), &revoked)
+	revoked["refresh_token"] = "revoked-refresh-token"
+	source.Credentials, _ = json.Marshal(revoked)
+	calendarClient, err = NewGoogleCalendarClient(context.Background(), source, Options{Access: ReadOnly})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := calendarClient.ListEvents(context.Background(), models.Version{}); err == nil || !strings.Contains(err.Error(), "invalid_grant") {
+		t.Errorf("expected a revoked refresh token to be rejected, got %v", err)
+	}
+
+	source.Impersonate = "alice@example.com"
+	if _, err := NewGoogleCalendarClient(context.Background(), source, Options{Access: ReadOnly}); err == nil || !strings.Contains(err.Error(), "impersonate requires service account credentials") {
+		t.Errorf("expected impersonate to be rejected with authorized_user credentials, got %v", err)
+	}
+}
+
+func TestValidateGoogleSource(t *testing.T) {
+	credentials := json.RawMessage(`{"type": "service_account"}`)
+	for _, test := range []struct {
+		name          string
+		source        models.Source
+		expectedError string
+	}{
+		{
+			name:   "with a calendar and credentials",
+			source: models.Source{CalendarId: testCalendarId, Credentials: credentials},
+		},
+		{
+			name:          "without a calendar",
+			source:        models.Source{Credentials: credentials},
+			expectedError: "one of source.calendar_id, source.calendar_ids or source.calendar_name must be set for the google provider",
+		},
+		{
+			name:          "with calendar_id and calendar_name",
+			source:        models.Source{CalendarId: testCalendarId, CalendarName: "Team", Credentials: credentials},
+			expectedError: "only one of source.calendar_id, source.calendar_ids or source.calendar_name may be set",
+		},
+		{
+			name:          "with an empty calendar in calendar_ids",
+			source:        models.Source{CalendarIds: []string{testCalendarId, ""}, Credentials: credentials},
+			expectedError: "source.calendar_ids[1] must not be empty",
+		},
+		{
+			name:          "without credentials",
+			source:        models.Source{CalendarId: testCalendarId},
+			expectedError: "one of source.credentials, source.credentials_file or source.credentials_env must be set for the google provider",
+		},
+		{
+			name:          "with credentials and credentials_file",
+			source:        models.Source{CalendarId: testCalendarId, Credentials: credentials, CredentialsFile: "credentials.json"},
+			expectedError: "only one of source.credentials, source.credentials_file or source.credentials_env may be set",
+		},
+		{
+			name:          "with a gate without a calendar",
+			source:        models.Source{CalendarId: testCalendarId, Credentials: credentials, Gate: &models.Gate{EventName: "Freeze"}},
+			expectedError: "source.gate.calendar_id must be set when source.gate is used",
+		},
+		{
+			name:          "with local events",
+			source:        models.Source{CalendarId: testCalendarId, Credentials: credentials, Events: []models.LocalEvent{{Summary: "Deploy"}}},
+			expectedError: "source.events is only supported by the local provider",
+		},
+		{
+			name:          "with a relative endpoint",
+			source:        models.Source{CalendarId: testCalendarId, Credentials: credentials, Endpoint: "calendar/v3"},
+			expectedError: "source.endpoint must be an absolute URL, got 'calendar/v3'",
+		},
+	} {
+		err := validateGoogleSource(test.source)
+		if test.expectedError == "" {
+			if err != nil {
+				t.Errorf("%v: expected no error, got %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.expectedError {
+			t.Errorf("%v: expected error %q, got %v", test.name, test.expectedError, err)
+		}
+	}
+}
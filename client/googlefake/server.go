@@ -0,0 +1,454 @@
+// Package googlefake provides an in-memory stand-in for the Google Calendar
+// API, for testing the calendar resource without a real calendar. Point
+// `source.endpoint` and the `token_uri` of the credentials at the server.
+package googlefake
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	googleCalendarAPI "google.golang.org/api/calendar/v3"
+)
+
+// Server is a fake Google Calendar API server. It supports listing, getting
+// and inserting events, listing calendars, querying free/busy, and issues
+// access tokens to any caller.
+type Server struct {
+	*httptest.Server
+
+	// TimeZone is reported as the time zone of every calendar.
+	TimeZone string
+
+	mu           sync.Mutex
+	calendars    map[string][]*googleCalendarAPI.Event
+	calendarList []*googleCalendarAPI.CalendarListEntry
+	eventTypes   map[string]string
+	failures     []int
+	nextId       int
+	requests     int
+	subjects     []string
+}
+
+func NewServer() *Server {
+	s := &Server{
+		TimeZone:   "UTC",
+		calendars:  map[string][]*googleCalendarAPI.Event{},
+		eventTypes: map[string]string{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+// TokenURL is the URL to use as the token_uri of credentials.
+func (s *Server) TokenURL() string {
+	return s.URL + "/token"
+}
+
+// Credentials returns service account credentials whose tokens are issued
+// by the server.
+func (s *Server) Credentials() []byte {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		panic(err)
+	}
+	privateKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	})
+	credentials, err := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"private_key":  string(privateKey),
+		"client_email": "calendar-resource@fake.iam.gserviceaccount.com",
+		"token_uri":    s.TokenURL(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return credentials
+}
+
+// RefreshToken is the refresh token accepted by the server.
+const RefreshToken = "fake-refresh-token"
+
+// AuthorizedUserCredentials returns OAuth2 user credentials whose refresh
+// token is exchanged for access tokens by the server.
+func (s *Server) AuthorizedUserCredentials() []byte {
+	credentials, err := json.Marshal(map[string]string{
+		"type":          "authorized_user",
+		"client_id":     "calendar-resource.apps.googleusercontent.com",
+		"client_secret": "fake-client-secret",
+		"refresh_token": RefreshToken,
+		"token_uri":     s.TokenURL(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	return credentials
+}
+
+// AddEvent adds an event to a calendar, assigning it an ID if it has none.
+func (s *Server) AddEvent(calendarId string, event *googleCalendarAPI.Event) *googleCalendarAPI.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addEvent(calendarId, event)
+}
+
+// AddCalendar adds an empty calendar with the given display name to the
+// account's calendar list.
+func (s *Server) AddCalendar(calendarId, summary string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.calendars[calendarId]; !ok {
+		s.calendars[calendarId] = []*googleCalendarAPI.Event{}
+	}
+	s.calendarList = append(s.calendarList, &googleCalendarAPI.CalendarListEntry{
+		Kind:    "calendar#calendarListEntry",
+		Id:      calendarId,
+		Summary: summary,
+	})
+}
+
+// SetEventType sets the eventType reported for an event when events are
+// listed. The vendored Calendar API client has no field for it.
+func (s *Server) SetEventType(eventId, eventType string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.eventTypes[eventId] = eventType
+}
+
+// Events returns the events in a calendar.
+func (s *Server) Events(calendarId string) []*googleCalendarAPI.Event {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*googleCalendarAPI.Event{}, s.calendars[calendarId]...)
+}
+
+// FailNext makes the next API requests fail with the given status codes, in
+// order.
+func (s *Server) FailNext(statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, statusCodes...)
+}
+
+// Requests returns the number of API requests received, excluding requests
+// for tokens.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// Subjects returns the sub claim of each service account token request in
+// order, which names the user impersonated or is empty.
+func (s *Server) Subjects() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.subjects...)
+}
+
+// assertionSubject returns the sub claim of the JWT a service account
+// exchanges for an access token.
+func assertionSubject(assertion string) (string, error) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("assertion is not a JWT")
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return "", err
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", err
+	}
+	return claims.Sub, nil
+}
+
+func (s *Server) addEvent(calendarId string, event *googleCalendarAPI.Event) *googleCalendarAPI.Event {
+	if event.Id == "" {
+		s.nextId++
+		event.Id = fmt.Sprintf("event%d", s.nextId)
+	}
+	if event.Status == "" {
+		event.Status = "confirmed"
+	}
+	s.calendars[calendarId] = append(s.calendars[calendarId], event)
+	return event
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		// Refresh tokens other than the one in AuthorizedUserCredentials are
+		// rejected, as Google does for revoked tokens.
+		r.ParseForm()
+		if r.PostForm.Get("grant_type") == "refresh_token" && r.PostForm.Get("refresh_token") != RefreshToken {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			writeJSON(w, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		if assertion := r.PostForm.Get("assertion"); assertion != "" {
+			sub, err := assertionSubject(assertion)
+			if err != nil {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				writeJSON(w, map[string]string{"error": "invalid_grant"})
+				return
+			}
+			s.mu.Lock()
+			s.subjects = append(s.subjects, sub)
+			s.mu.Unlock()
+		}
+		writeJSON(w, map[string]interface{}{
+			"access_token": "fake-access-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests++
+	if len(s.failures) > 0 {
+		statusCode := s.failures[0]
+		s.failures = s.failures[1:]
+		writeError(w, statusCode, "injected failure")
+		return
+	}
+
+	// Paths have the form /calendars/{calendarId}[/events[/{eventId}]].
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	switch {
+	case r.URL.Path == "/users/me/calendarList" && r.Method == "GET":
+		writeJSON(w, &googleCalendarAPI.CalendarList{
+			Kind:  "calendar#calendarList",
+			Items: s.calendarList,
+		})
+	case len(parts) == 2 && parts[0] == "calendars" && r.Method == "GET":
+		s.getCalendar(w, parts[1])
+	case r.URL.Path == "/freeBusy" && r.Method == "POST":
+		s.queryFreeBusy(w, r)
+	case len(parts) == 3 && parts[0] == "calendars" && parts[2] == "events" && r.Method == "GET":
+		s.listEvents(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "calendars" && parts[2] == "events" && r.Method == "POST":
+		s.insertEvent(w, r, parts[1])
+	case len(parts) == 4 && parts[0] == "calendars" && parts[2] == "events" && r.Method == "GET":
+		s.getEvent(w, parts[1], parts[3])
+	default:
+		writeError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func (s *Server) listEvents(w http.ResponseWriter, r *http.Request, calendarId string) {
+	events, ok := s.calendars[calendarId]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	timeMin, err := parseQueryTime(r, "timeMin")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	timeMax, err := parseQueryTime(r, "timeMax")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	items := []*googleCalendarAPI.Event{}
+	for _, event := range events {
+		if event.Status == "cancelled" && r.URL.Query().Get("showDeleted") != "true" {
+			continue
+		}
+		if !timeMin.IsZero() && !s.eventTime(event.End).After(timeMin) {
+			continue
+		}
+		if !timeMax.IsZero() && !s.eventTime(event.Start).Before(timeMax) {
+			continue
+		}
+		items = append(items, event)
+	}
+	if r.URL.Query().Get("orderBy") == "startTime" {
+		sort.Stable(byStartTime{items, s})
+	}
+	listed := []map[string]interface{}{}
+	for _, item := range items {
+		fields, err := toFields(item)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if eventType, ok := s.eventTypes[item.Id]; ok {
+			fields["eventType"] = eventType
+		}
+		listed = append(listed, fields)
+	}
+	writeJSON(w, map[string]interface{}{
+		"kind":     "calendar#events",
+		"timeZone": s.TimeZone,
+		"items":    listed,
+	})
+}
+
+// queryFreeBusy reports a calendar as busy during its events which are
+// neither cancelled nor transparent.
+func (s *Server) queryFreeBusy(w http.ResponseWriter, r *http.Request) {
+	var request googleCalendarAPI.FreeBusyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	timeMin, errMin := time.Parse(time.RFC3339, request.TimeMin)
+	timeMax, errMax := time.Parse(time.RFC3339, request.TimeMax)
+	if errMin != nil || errMax != nil {
+		writeError(w, http.StatusBadRequest, "Invalid time range")
+		return
+	}
+	response := &googleCalendarAPI.FreeBusyResponse{
+		Kind:      "calendar#freeBusy",
+		TimeMin:   request.TimeMin,
+		TimeMax:   request.TimeMax,
+		Calendars: map[string]googleCalendarAPI.FreeBusyCalendar{},
+	}
+	for _, item := range request.Items {
+		events, ok := s.calendars[item.Id]
+		if !ok {
+			response.Calendars[item.Id] = googleCalendarAPI.FreeBusyCalendar{
+				Errors: []*googleCalendarAPI.Error{{Domain: "global", Reason: "notFound"}},
+			}
+			continue
+		}
+		calendar := googleCalendarAPI.FreeBusyCalendar{Busy: []*googleCalendarAPI.TimePeriod{}}
+		for _, event := range events {
+			start, end := s.eventTime(event.Start), s.eventTime(event.End)
+			if event.Status == "cancelled" || event.Transparency == "transparent" {
+				continue
+			}
+			if !end.After(timeMin) || !start.Before(timeMax) {
+				continue
+			}
+			calendar.Busy = append(calendar.Busy, &googleCalendarAPI.TimePeriod{
+				Start: start.UTC().Format(time.RFC3339),
+				End:   end.UTC().Format(time.RFC3339),
+			})
+		}
+		response.Calendars[item.Id] = calendar
+	}
+	writeJSON(w, response)
+}
+
+func (s *Server) getCalendar(w http.ResponseWriter, calendarId string) {
+	if _, ok := s.calendars[calendarId]; !ok {
+		writeError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	writeJSON(w, &googleCalendarAPI.Calendar{
+		Kind:     "calendar#calendar",
+		Id:       calendarId,
+		TimeZone: s.TimeZone,
+	})
+}
+
+func (s *Server) getEvent(w http.ResponseWriter, calendarId, eventId string) {
+	for _, event := range s.calendars[calendarId] {
+		if event.Id == eventId {
+			writeJSON(w, event)
+			return
+		}
+	}
+	writeError(w, http.StatusNotFound, "Not Found")
+}
+
+func (s *Server) insertEvent(w http.ResponseWriter, r *http.Request, calendarId string) {
+	var event googleCalendarAPI.Event
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if event.Start == nil || event.End == nil {
+		writeError(w, http.StatusBadRequest, "Missing time")
+		return
+	}
+	event.Created = time.Now().UTC().Format(time.RFC3339)
+	event.Updated = event.Created
+	writeJSON(w, s.addEvent(calendarId, &event))
+}
+
+func parseQueryTime(r *http.Request, name string) (time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid %v", name)
+	}
+	return t, nil
+}
+
+// eventTime returns the instant of an event's start or end, treating the
+// date of an all-day event as midnight in the calendar's time zone.
+func (s *Server) eventTime(eventDateTime *googleCalendarAPI.EventDateTime) time.Time {
+	if eventDateTime.DateTime != "" {
+		t, _ := time.Parse(time.RFC3339, eventDateTime.DateTime)
+		return t
+	}
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	t, _ := time.ParseInLocation("2006-01-02", eventDateTime.Date, loc)
+	return t
+}
+
+type byStartTime struct {
+	events []*googleCalendarAPI.Event
+	server *Server
+}
+
+func (b byStartTime) Len() int      { return len(b.events) }
+func (b byStartTime) Swap(i, j int) { b.events[i], b.events[j] = b.events[j], b.events[i] }
+func (b byStartTime) Less(i, j int) bool {
+	return b.server.eventTime(b.events[i].Start).Before(b.server.eventTime(b.events[j].Start))
+}
+
+func toFields(event *googleCalendarAPI.Event) (map[string]interface{}, error) {
+	encoded, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(encoded, &fields)
+	return fields, err
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    statusCode,
+			"message": message,
+		},
+	})
+}
@@ -0,0 +1,216 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+// occurrenceIdLayout formats the start time appended to a local event's ID
+// to identify one occurrence of it.
+const occurrenceIdLayout = "20060102T150405Z"
+
+func init() {
+	Register("local", NewLocalCalendarClient)
+	RegisterValidator("local", validateLocalSource)
+}
+
+// LocalCalendarClient is a Provider which evaluates the events defined in
+// the source configuration in-process, without a remote calendar.
+type LocalCalendarClient struct {
+	Source models.Source
+}
+
+func NewLocalCalendarClient(ctx context.Context, source models.Source, options Options) (CalendarClient, error) {
+	return NewEventClient(source, &LocalCalendarClient{
+		Source: source,
+	}), nil
+}
+
+func validateLocalSource(s models.Source) error {
+	if len(s.Events) == 0 {
+		return fmt.Errorf("source.events must be set for the local provider")
+	}
+	for i, event := range s.Events {
+		if event.Summary == "" {
+			return fmt.Errorf("source.events[%d].summary must be set", i)
+		}
+		if event.Start == "" {
+			return fmt.Errorf("source.events[%d].start must be set", i)
+		}
+		if event.End == "" {
+			return fmt.Errorf("source.events[%d].end must be set", i)
+		}
+	}
+	if s.Gate != nil {
+		return fmt.Errorf("source.gate is not supported by the local provider")
+	}
+	if len(s.CalendarIds) > 0 {
+		return fmt.Errorf("source.calendar_ids is not supported by the local provider")
+	}
+	if s.CalendarName != "" {
+		return fmt.Errorf("source.calendar_name is not supported by the local provider")
+	}
+	if s.Mode == ModeFreeBusy {
+		return fmt.Errorf("source.mode freebusy is not supported by the local provider")
+	}
+	if s.TriggerOn == TriggerOnCreated || s.TriggerOn == TriggerOnUpdated {
+		return fmt.Errorf("source.trigger_on '%v' is not supported by the local provider", s.TriggerOn)
+	}
+	if s.Endpoint != "" {
+		return fmt.Errorf("source.endpoint is not supported by the local provider")
+	}
+	return nil
+}
+
+// localOccurrence is a single occurrence of a local event.
+type localOccurrence struct {
+	Id    string
+	Event models.LocalEvent
+	Start time.Time
+	End   time.Time
+}
+
+func (o localOccurrence) toEvent() models.Event {
+	event := models.Event{
+		Id:           o.Id,
+		Summary:      o.Event.Summary,
+		Description:  o.Event.Description,
+		Start:        o.Start,
+		End:          o.End,
+		TimeZone:     o.Event.TimeZone,
+		Status:       "confirmed",
+		EventType:    "default",
+		Transparency: "busy",
+	}
+	if o.Event.RRule != "" {
+		event.Recurrence = []string{"RRULE:" + strings.TrimPrefix(o.Event.RRule, "RRULE:")}
+	}
+	return event
+}
+
+// Events ignores the calendar ID, as the local provider has a single
+// calendar.
+func (lcc *LocalCalendarClient) Events(ctx context.Context, calendarId string, timeMin, timeMax time.Time) ([]models.Event, error) {
+	var events []models.Event
+	for i, event := range lcc.Source.Events {
+		err := lcc.occurrences(i, event, timeMax, func(occurrence localOccurrence) {
+			if occurrence.End.After(timeMin) && occurrence.Start.Before(timeMax) {
+				events = append(events, occurrence.toEvent())
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Sort(byEventStart(events))
+	return events, nil
+}
+
+func (lcc *LocalCalendarClient) Event(ctx context.Context, calendarId, eventId string) (models.Event, error) {
+	occurrence, err := lcc.findOccurrence(eventId)
+	if err != nil {
+		return models.Event{}, err
+	}
+	return occurrence.toEvent(), nil
+}
+
+func (lcc *LocalCalendarClient) InsertEvent(ctx context.Context, calendarId string, event models.Event) (models.Event, error) {
+	return models.Event{}, fmt.Errorf("The local provider does not support adding events")
+}
+
+// occurrences calls fn with every occurrence of the event at index i which
+// starts no later than limit.
+func (lcc *LocalCalendarClient) occurrences(i int, event models.LocalEvent, limit time.Time, fn func(localOccurrence)) error {
+	start, end, err := lcc.parseEventTimes(event)
+	if err != nil {
+		return err
+	}
+	duration := end.Sub(start)
+	id := event.Id
+	if id == "" {
+		id = fmt.Sprintf("event%d", i)
+	}
+	newOccurrence := func(t time.Time) localOccurrence {
+		return localOccurrence{
+			Id:    id + "_" + t.UTC().Format(occurrenceIdLayout),
+			Event: event,
+			Start: t,
+			End:   t.Add(duration),
+		}
+	}
+	if event.RRule == "" {
+		if !start.After(limit) {
+			fn(newOccurrence(start))
+		}
+		return nil
+	}
+	rule, err := parseRecurrenceRule(event.RRule)
+	if err != nil {
+		return fmt.Errorf("parsing rrule of local event '%v': %v", event.Summary, err)
+	}
+	rule.occurrences(start, limit, func(t time.Time) bool {
+		fn(newOccurrence(t))
+		return true
+	})
+	return nil
+}
+
+// findOccurrence locates the occurrence identified by a version ID.
+func (lcc *LocalCalendarClient) findOccurrence(versionId string) (localOccurrence, error) {
+	separator := strings.LastIndex(versionId, "_")
+	if separator == -1 {
+		return localOccurrence{}, fmt.Errorf("malformed event ID '%v'", versionId)
+	}
+	start, err := time.Parse(occurrenceIdLayout, versionId[separator+1:])
+	if err != nil {
+		return localOccurrence{}, fmt.Errorf("malformed event ID '%v'", versionId)
+	}
+	var found *localOccurrence
+	for i, event := range lcc.Source.Events {
+		err := lcc.occurrences(i, event, start, func(occurrence localOccurrence) {
+			if occurrence.Id == versionId {
+				found = &occurrence
+			}
+		})
+		if err != nil {
+			return localOccurrence{}, err
+		}
+	}
+	if found == nil {
+		return localOccurrence{}, fmt.Errorf("event '%v' not found", versionId)
+	}
+	return *found, nil
+}
+
+func (lcc *LocalCalendarClient) parseEventTimes(event models.LocalEvent) (time.Time, time.Time, error) {
+	start, err := time.Parse(time.RFC3339, event.Start)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("parsing local event start time: %v", err)
+	}
+	end, err := time.Parse(time.RFC3339, event.End)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("parsing local event end time: %v", err)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("parsing local event times: Event '%v' must end after it starts", event.Summary)
+	}
+	timeZone := event.TimeZone
+	if timeZone == "" {
+		timeZone = lcc.Source.TimeZone
+	}
+	if timeZone != "" {
+		// Recurrences keep the same wall clock time in the event's time zone
+		// across daylight saving changes.
+		loc, err := loadLocation(timeZone)
+		if err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("parsing local event time zone: %v", err)
+		}
+		start, end = start.In(loc), end.In(loc)
+	}
+	return start, end, nil
+}
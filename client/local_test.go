@@ -0,0 +1,177 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+func newTestLocalProvider(events ...models.LocalEvent) *LocalCalendarClient {
+	return &LocalCalendarClient{Source: models.Source{Provider: "local", EventName: "Deploy window", Events: events}}
+}
+
+func TestLocalEventsWithinWindow(t *testing.T) {
+	provider := newTestLocalProvider(
+		models.LocalEvent{Id: "window", Summary: "Deploy window", Start: "2016-10-24T09:00:00Z", End: "2016-10-24T11:00:00Z", RRule: "FREQ=DAILY"},
+		models.LocalEvent{Summary: "Retro", Start: "2016-10-25T10:30:00Z", End: "2016-10-25T11:30:00Z"},
+	)
+	events, err := provider.Events(context.Background(), "", mustParseTime(t, "2016-10-25T10:00:00Z"), mustParseTime(t, "2016-10-26T09:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []string{}
+	for _, event := range events {
+		ids = append(ids, event.Id)
+	}
+	// The occurrence starting exactly at timeMax is excluded, as is the one
+	// which ended before timeMin.
+	expected := []string{"window_20161025T090000Z", "event1_20161025T103000Z"}
+	if !reflect.DeepEqual(ids, expected) {
+		t.Errorf("expected events %v, got %v", expected, ids)
+	}
+}
+
+func TestLocalFindOccurrenceRoundTripsVersionIds(t *testing.T) {
+	provider := newTestLocalProvider(
+		models.LocalEvent{Id: "window", Summary: "Deploy window", Start: "2016-10-24T09:00:00Z", End: "2016-10-24T11:00:00Z", RRule: "FREQ=WEEKLY;BYDAY=MO,WE"},
+	)
+	start := mustParseTime(t, "2016-11-02T09:00:00Z")
+	events, err := provider.Events(context.Background(), "", start, start.Add(time.Nanosecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 1 {
+		t.Fatalf("expected one occurrence, got %v", events)
+	}
+	version := newVersion(events[0].Id, events[0].Start)
+	event, err := provider.Event(context.Background(), "", version.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(event, events[0]) {
+		t.Errorf("expected event %+v, got %+v", events[0], event)
+	}
+
+	for _, id := range []string{"window", "window_yesterday", "window_20161101T090000Z", "missing_20161102T090000Z"} {
+		if _, err := provider.Event(context.Background(), "", id); err == nil {
+			t.Errorf("expected an error finding '%v'", id)
+		}
+	}
+}
+
+func TestLocalEventsErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		event    models.LocalEvent
+		expected string
+	}{
+		{
+			name:     "with a malformed start",
+			event:    models.LocalEvent{Summary: "Deploy window", Start: "Monday", End: "2016-10-24T11:00:00Z"},
+			expected: "parsing local event start time",
+		},
+		{
+			name:     "ending before it starts",
+			event:    models.LocalEvent{Summary: "Deploy window", Start: "2016-10-24T11:00:00Z", End: "2016-10-24T09:00:00Z"},
+			expected: "Event 'Deploy window' must end after it starts",
+		},
+		{
+			name:     "with an unknown time zone",
+			event:    models.LocalEvent{Summary: "Deploy window", Start: "2016-10-24T09:00:00Z", End: "2016-10-24T11:00:00Z", TimeZone: "Europe/Atlantis"},
+			expected: "parsing local event time zone",
+		},
+		{
+			name:     "with a malformed rrule",
+			event:    models.LocalEvent{Summary: "Deploy window", Start: "2016-10-24T09:00:00Z", End: "2016-10-24T11:00:00Z", RRule: "FREQ=FORTNIGHTLY"},
+			expected: "parsing rrule of local event 'Deploy window'",
+		},
+	} {
+		provider := newTestLocalProvider(test.event)
+		from := mustParseTime(t, "2016-10-24T00:00:00Z")
+		if _, err := provider.Events(context.Background(), "", from, from.Add(48*time.Hour)); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%v: expected an error containing '%v', got %v", test.name, test.expected, err)
+		}
+		if _, err := provider.Event(context.Background(), "", "event0_20161024T090000Z"); err == nil || !strings.Contains(err.Error(), test.expected) {
+			t.Errorf("%v: expected finding an occurrence to fail with '%v', got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestValidateLocalSource(t *testing.T) {
+	events := []models.LocalEvent{{Summary: "Deploy", Start: "2016-10-24T09:00:00Z", End: "2016-10-24T11:00:00Z"}}
+	for _, test := range []struct {
+		name          string
+		source        models.Source
+		expectedError string
+	}{
+		{
+			name:   "with events",
+			source: models.Source{Events: events},
+		},
+		{
+			name:          "without events",
+			source:        models.Source{},
+			expectedError: "source.events must be set for the local provider",
+		},
+		{
+			name:          "with an event without a summary",
+			source:        models.Source{Events: append(events, models.LocalEvent{Start: "2016-10-24T09:00:00Z", End: "2016-10-24T11:00:00Z"})},
+			expectedError: "source.events[1].summary must be set",
+		},
+		{
+			name:          "with an event without a start",
+			source:        models.Source{Events: []models.LocalEvent{{Summary: "Deploy", End: "2016-10-24T11:00:00Z"}}},
+			expectedError: "source.events[0].start must be set",
+		},
+		{
+			name:          "with an event without an end",
+			source:        models.Source{Events: []models.LocalEvent{{Summary: "Deploy", Start: "2016-10-24T09:00:00Z"}}},
+			expectedError: "source.events[0].end must be set",
+		},
+		{
+			name:          "with a gate",
+			source:        models.Source{Events: events, Gate: &models.Gate{CalendarId: "freeze@example.com"}},
+			expectedError: "source.gate is not supported by the local provider",
+		},
+		{
+			name:          "with calendar_ids",
+			source:        models.Source{Events: events, CalendarIds: []string{"team@example.com"}},
+			expectedError: "source.calendar_ids is not supported by the local provider",
+		},
+		{
+			name:          "with calendar_name",
+			source:        models.Source{Events: events, CalendarName: "Team"},
+			expectedError: "source.calendar_name is not supported by the local provider",
+		},
+		{
+			name:          "in freebusy mode",
+			source:        models.Source{Events: events, Mode: ModeFreeBusy},
+			expectedError: "source.mode freebusy is not supported by the local provider",
+		},
+		{
+			name:          "triggering on updated events",
+			source:        models.Source{Events: events, TriggerOn: TriggerOnUpdated},
+			expectedError: "source.trigger_on 'updated' is not supported by the local provider",
+		},
+		{
+			name:          "with an endpoint",
+			source:        models.Source{Events: events, Endpoint: "http://localhost:8080/"},
+			expectedError: "source.endpoint is not supported by the local provider",
+		},
+	} {
+		err := validateLocalSource(test.source)
+		if test.expectedError == "" {
+			if err != nil {
+				t.Errorf("%v: expected no error, got %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.expectedError {
+			t.Errorf("%v: expected error %q, got %v", test.name, test.expectedError, err)
+		}
+	}
+}
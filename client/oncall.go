@@ -0,0 +1,179 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+// onCallHorizon is how far ahead a get step looks for the next on-call
+// shift.
+const onCallHorizon = 31 * 24 * time.Hour
+
+// OnCallParams asks a get step to write on_call.json. Shifts are events
+// named EventName, which defaults to the source's event_name. It is decoded
+// from true or from an object.
+type OnCallParams struct {
+	EventName string `json:"event_name,omitempty"`
+}
+
+func (p *OnCallParams) UnmarshalJSON(data []byte) error {
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		if !enabled {
+			return fmt.Errorf("on_call must be true or an object")
+		}
+		return nil
+	}
+	type onCallParams OnCallParams
+	return json.Unmarshal(data, (*onCallParams)(p))
+}
+
+// OnCall is the content of on_call.json. Now lists who is on call, and Next
+// who takes over at the Handover time, which is empty if no later shift is
+// scheduled.
+type OnCall struct {
+	Now      []OnCallShift `json:"now"`
+	Next     []OnCallShift `json:"next"`
+	Handover string        `json:"handover"`
+}
+
+// OnCallShift is one person's shift. Name is taken from a summary such as
+// "On call: alice", otherwise from the event's attendees, which also give
+// an Email.
+type OnCallShift struct {
+	Name       string `json:"name"`
+	Email      string `json:"email,omitempty"`
+	Start      string `json:"start"`
+	End        string `json:"end"`
+	EventId    string `json:"event_id"`
+	CalendarId string `json:"calendar_id,omitempty"`
+
+	start time.Time
+}
+
+type byShiftStart []OnCallShift
+
+func (s byShiftStart) Len() int      { return len(s) }
+func (s byShiftStart) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byShiftStart) Less(i, j int) bool {
+	if !s[i].start.Equal(s[j].start) {
+		return s[i].start.Before(s[j].start)
+	}
+	return s[i].Name < s[j].Name
+}
+
+// writeOnCall writes on_call.json to the target directory, listing who is
+// on call at the given time and who is next.
+func (ec *EventClient) writeOnCall(ctx context.Context, params OnCallParams, now time.Time, targetDirectory string) error {
+	onCall, err := ec.onCall(ctx, params, now)
+	if err != nil {
+		return fmt.Errorf("finding who is on call: %v", err)
+	}
+	file, err := os.Create(filepath.Join(targetDirectory, "on_call.json"))
+	if err != nil {
+		return fmt.Errorf("creating on_call.json: %v", err)
+	}
+	defer file.Close()
+	if err := json.NewEncoder(file).Encode(onCall); err != nil {
+		return fmt.Errorf("writing on_call.json: %v", err)
+	}
+	return nil
+}
+
+func (ec *EventClient) onCall(ctx context.Context, params OnCallParams, now time.Time) (OnCall, error) {
+	eventName := params.EventName
+	if eventName == "" {
+		eventName = ec.Source.EventName
+	}
+	if eventName == "" {
+		return OnCall{}, fmt.Errorf("params.on_call.event_name must be set when source.event_name is not")
+	}
+	// Times are written in the source's time zone, or UTC, whatever the
+	// offsets of the events.
+	loc := time.UTC
+	if ec.Source.TimeZone != "" {
+		var err error
+		if loc, err = loadLocation(ec.Source.TimeZone); err != nil {
+			return OnCall{}, err
+		}
+	}
+	onCall := OnCall{Now: []OnCallShift{}, Next: []OnCallShift{}}
+	var next time.Time
+	for _, calendarId := range ec.Source.Calendars() {
+		events, err := ec.Provider.Events(ctx, calendarId, now, now.Add(onCallHorizon))
+		if err != nil {
+			return OnCall{}, err
+		}
+		for _, event := range events {
+			matches, err := ec.matchesFilters(event)
+			if err != nil {
+				return OnCall{}, err
+			}
+			if !matches {
+				continue
+			}
+			shifts, ok := onCallShifts(event, eventName, loc)
+			if !ok {
+				continue
+			}
+			if len(ec.Source.CalendarIds) > 0 {
+				for i := range shifts {
+					shifts[i].CalendarId = calendarId
+				}
+			}
+			switch {
+			case event.Active(now):
+				onCall.Now = append(onCall.Now, shifts...)
+			case next.IsZero() || event.Start.Before(next):
+				next = event.Start
+				onCall.Next = shifts
+			case event.Start.Equal(next):
+				onCall.Next = append(onCall.Next, shifts...)
+			}
+		}
+	}
+	sort.Sort(byShiftStart(onCall.Now))
+	sort.Sort(byShiftStart(onCall.Next))
+	onCall.Handover = formatTime(next.In(loc))
+	return onCall, nil
+}
+
+// onCallShifts returns the shifts described by an event named eventName,
+// either exactly or followed by a colon and the name of the person on call,
+// with times written in loc.
+func onCallShifts(event models.Event, eventName string, loc *time.Location) ([]OnCallShift, bool) {
+	shift := OnCallShift{
+		Start:   formatTime(event.Start.In(loc)),
+		End:     formatTime(event.End.In(loc)),
+		EventId: event.Id,
+		start:   event.Start,
+	}
+	name, named := summaryQualifier(event.Summary, eventName)
+	if !named {
+		return nil, false
+	}
+	if name != "" {
+		shift.Name = name
+		return []OnCallShift{shift}, true
+	}
+	shifts := []OnCallShift{}
+	for _, attendee := range event.Attendees {
+		if attendee.Resource || attendee.ResponseStatus == "declined" {
+			continue
+		}
+		shift.Name = attendee.DisplayName
+		if shift.Name == "" {
+			shift.Name = attendee.Email
+		}
+		shift.Email = attendee.Email
+		shifts = append(shifts, shift)
+	}
+	return shifts, true
+}
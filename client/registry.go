@@ -0,0 +1,121 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+// Access is the level of access to a calendar that a command needs.
+type Access int
+
+const (
+	ReadOnly Access = iota
+	ReadWrite
+)
+
+// Options are passed to a provider's Factory when building its client.
+type Options struct {
+	Access Access
+}
+
+// Factory builds the CalendarClient for a source.
+type Factory func(ctx context.Context, source models.Source, options Options) (CalendarClient, error)
+
+// Validator checks the source fields specific to a provider, returning an
+// error naming the offending field.
+type Validator func(source models.Source) error
+
+var (
+	providersMu sync.RWMutex
+	factories   = map[string]Factory{}
+	validators  = map[string]Validator{}
+	fields      = map[string][]string{}
+)
+
+// Register makes a calendar provider available under a name, which is
+// matched against `source.provider`. Providers in other packages should call
+// it from an init function, and be imported by the commands for effect.
+// Register panics if it is called twice for the same name.
+func Register(name string, factory Factory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if factory == nil {
+		panic("client: Register factory is nil")
+	}
+	if _, registered := factories[name]; registered {
+		panic("client: Register called twice for provider " + name)
+	}
+	factories[name] = factory
+}
+
+// RegisterValidator sets the Validator run for sources using a provider.
+func RegisterValidator(name string, validator Validator) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	validators[name] = validator
+}
+
+// RegisterFields declares top-level source keys specific to a provider, so
+// that sources using it may set them. Their raw values are passed to the
+// provider's Validator and Factory in source.Extra.
+func RegisterFields(name string, keys ...string) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	fields[name] = append(fields[name], keys...)
+}
+
+// Providers returns the names of the registered providers, sorted.
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	var names []string
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidateSource checks the source's common fields, that its provider is
+// registered, and the fields specific to that provider.
+func ValidateSource(source models.Source) error {
+	providersMu.RLock()
+	_, registered := factories[source.Provider]
+	validator := validators[source.Provider]
+	allowed := fields[source.Provider]
+	providersMu.RUnlock()
+	if err := source.Validate(allowed...); err != nil {
+		return err
+	}
+	if source.Provider == "" {
+		return fmt.Errorf("source.provider must be set")
+	}
+	if !registered {
+		return fmt.Errorf("source.provider '%v' is not supported, use one of %v", source.Provider, strings.Join(Providers(), ", "))
+	}
+	if validator != nil {
+		return validator(source)
+	}
+	return nil
+}
+
+// NewCalendarClient builds a client using the factory registered for the
+// source's provider.
+func NewCalendarClient(ctx context.Context, source models.Source, options Options) (CalendarClient, error) {
+	source, err := resolveCredentials(source)
+	if err != nil {
+		return nil, fmt.Errorf("resolving credentials: %v", err)
+	}
+	providersMu.RLock()
+	factory, registered := factories[source.Provider]
+	providersMu.RUnlock()
+	if !registered {
+		return nil, fmt.Errorf("Provider '%v' is not supported", source.Provider)
+	}
+	return factory(ctx, source, options)
+}
@@ -0,0 +1,64 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+func TestRegisterFields(t *testing.T) {
+	var tenant string
+	Register("fields-test", func(ctx context.Context, source models.Source, options Options) (CalendarClient, error) {
+		if err := json.Unmarshal(source.Extra["tenant_id"], &tenant); err != nil {
+			return nil, err
+		}
+		return NewEventClient(source, nil), nil
+	})
+	RegisterValidator("fields-test", func(source models.Source) error {
+		if _, ok := source.Extra["tenant_id"]; !ok {
+			return fmt.Errorf("source.tenant_id must be set")
+		}
+		return nil
+	})
+	RegisterFields("fields-test", "tenant_id")
+
+	for _, test := range []struct {
+		source        string
+		expectedError string
+	}{
+		{`{"provider": "fields-test", "event_name": "Deploy", "tenant_id": "contoso"}`, ""},
+		{`{"provider": "fields-test", "event_name": "Deploy"}`, "source.tenant_id must be set"},
+		{`{"provider": "fields-test", "event_name": "Deploy", "tenant_id": "contoso", "tenant": "contoso"}`, "unknown field source.tenant"},
+		{`{"provider": "local", "event_name": "Deploy", "tenant_id": "contoso"}`, "unknown field source.tenant_id"},
+	} {
+		var source models.Source
+		if err := json.Unmarshal([]byte(test.source), &source); err != nil {
+			t.Fatal(err)
+		}
+		err := ValidateSource(source)
+		if test.expectedError == "" {
+			if err != nil {
+				t.Errorf("%v: expected the source to be valid, got %v", test.source, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), test.expectedError) {
+			t.Errorf("%v: expected an error containing %q, got %v", test.source, test.expectedError, err)
+		}
+	}
+
+	var source models.Source
+	if err := json.Unmarshal([]byte(`{"provider": "fields-test", "event_name": "Deploy", "tenant_id": "contoso"}`), &source); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCalendarClient(context.Background(), source, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	if tenant != "contoso" {
+		t.Errorf("expected the factory to decode tenant_id 'contoso', got '%v'", tenant)
+	}
+}
@@ -0,0 +1,151 @@
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenFetchErrorPrefix begins the errors the oauth2 package returns when a
+// token can't be fetched.
+const tokenFetchErrorPrefix = "oauth2: cannot fetch token: "
+
+const (
+	defaultRetryAttempts = 5
+	defaultRetryTimeout  = time.Minute
+	retryBaseDelay       = 500 * time.Millisecond
+	retryMaxDelay        = 30 * time.Second
+)
+
+// retryTransport is an http.RoundTripper which retries requests failing with
+// a 429 or a 5xx status, and idempotent requests failing with a network
+// error. It waits for the duration given by a Retry-After header, or
+// otherwise backs off exponentially, until the attempts or the total timeout
+// are used up or the request is cancelled.
+type retryTransport struct {
+	Base     http.RoundTripper
+	Attempts int
+	Timeout  time.Duration
+}
+
+func newRetryTransport(base http.RoundTripper, attempts int, timeout time.Duration) *retryTransport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if attempts < 1 {
+		attempts = defaultRetryAttempts
+	}
+	if timeout <= 0 {
+		timeout = defaultRetryTimeout
+	}
+	return &retryTransport{Base: base, Attempts: attempts, Timeout: timeout}
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// The body is buffered so that it can be sent again on each attempt.
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	deadline := time.Now().Add(t.Timeout)
+	for attempt := 1; ; attempt++ {
+		attemptReq := *req
+		if body != nil {
+			attemptReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+		}
+		resp, err := t.Base.RoundTrip(&attemptReq)
+		if attempt >= t.Attempts || req.Context().Err() != nil || !retryable(req, resp, err) {
+			return resp, err
+		}
+		wait := retryDelay(attempt, resp)
+		if time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			ioutil.ReadAll(resp.Body)
+			resp.Body.Close()
+		}
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryable reports whether a failed attempt may succeed if repeated. A
+// request which failed with a network error may already have been applied,
+// so only idempotent requests are repeated, and errors from the token
+// endpoint are only repeated when they may be transient.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return idempotent(req.Method) && !permanentTokenError(err)
+	}
+	return transientStatus(resp.StatusCode)
+}
+
+func transientStatus(statusCode int) bool {
+	return statusCode == http.StatusTooManyRequests || statusCode >= 500
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	return false
+}
+
+// permanentTokenError reports whether an error is from obtaining an OAuth2
+// token and will recur, such as an invalid_grant response to a revoked
+// refresh token. The oauth2 package reports these as plain errors, so they
+// are recognised by their message: a token endpoint response other than a
+// 429 or 5xx, or a malformed token.
+func permanentTokenError(err error) bool {
+	message := err.Error()
+	if !strings.HasPrefix(message, "oauth2: ") {
+		return false
+	}
+	status := strings.TrimPrefix(message, tokenFetchErrorPrefix)
+	if status == message {
+		return true
+	}
+	if !strings.Contains(status, "\nResponse: ") {
+		// The token endpoint couldn't be reached.
+		return false
+	}
+	statusCode, err := strconv.Atoi(strings.SplitN(status, " ", 2)[0])
+	return err != nil || !transientStatus(statusCode)
+}
+
+// retryDelay returns how long to wait before the next attempt, preferring
+// the server's Retry-After header over exponential backoff with jitter.
+func retryDelay(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if retryAfter := resp.Header.Get("Retry-After"); retryAfter != "" {
+			if seconds, err := strconv.Atoi(retryAfter); err == nil && seconds >= 0 {
+				return time.Duration(seconds) * time.Second
+			}
+			if date, err := http.ParseTime(retryAfter); err == nil {
+				if wait := date.Sub(time.Now()); wait > 0 {
+					return wait
+				}
+				return 0
+			}
+		}
+	}
+	delay := retryBaseDelay << uint(attempt-1)
+	if delay > retryMaxDelay || delay <= 0 {
+		delay = retryMaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRetryTransport(t *testing.T) {
+	networkError := errors.New("read tcp: connection reset by peer")
+	for _, test := range []struct {
+		name             string
+		method           string
+		statusCode       int
+		err              error
+		expectedAttempts int
+	}{
+		{"a GET failing with a network error", "GET", 0, networkError, 3},
+		{"a GET failing with a 503", "GET", http.StatusServiceUnavailable, nil, 3},
+		{"a GET failing with a 404", "GET", http.StatusNotFound, nil, 1},
+		{"a POST failing with a network error", "POST", 0, networkError, 1},
+		{"a POST failing with a 429", "POST", http.StatusTooManyRequests, nil, 3},
+		{"a POST failing with a 500", "POST", http.StatusInternalServerError, nil, 3},
+		{
+			"a revoked refresh token", "GET", 0,
+			errors.New(tokenFetchErrorPrefix + "400 Bad Request\nResponse: {\"error\": \"invalid_grant\"}"), 1,
+		},
+		{
+			"an unavailable token endpoint", "GET", 0,
+			errors.New(tokenFetchErrorPrefix + "503 Service Unavailable\nResponse: "), 3,
+		},
+		{
+			"an unreachable token endpoint", "GET", 0,
+			errors.New(tokenFetchErrorPrefix + "Post https://oauth2.googleapis.com/token: dial tcp: i/o timeout"), 3,
+		},
+		{"a missing refresh token", "GET", 0, errors.New("oauth2: token expired and refresh token is not set"), 1},
+	} {
+		attempts := 0
+		transport := newRetryTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			attempts++
+			if req.Body != nil {
+				if body, _ := ioutil.ReadAll(req.Body); string(body) != "{}" {
+					t.Errorf("%v: expected the body to be sent on every attempt, got %q", test.name, body)
+				}
+			}
+			if test.err != nil {
+				return nil, test.err
+			}
+			return &http.Response{
+				StatusCode: test.statusCode,
+				Header:     http.Header{"Retry-After": {"0"}},
+				Body:       ioutil.NopCloser(strings.NewReader("")),
+			}, nil
+		}), 3, time.Minute)
+		req, _ := http.NewRequest(test.method, "https://www.googleapis.com/calendar/v3/", strings.NewReader("{}"))
+		transport.RoundTrip(req)
+		if attempts != test.expectedAttempts {
+			t.Errorf("%v: expected %d attempts, got %d", test.name, test.expectedAttempts, attempts)
+		}
+	}
+}
+
+func TestRetryTransportStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	transport := newRetryTransport(roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		attempts++
+		cancel()
+		return nil, req.Context().Err()
+	}), 3, time.Minute)
+	req, _ := http.NewRequest("GET", "https://www.googleapis.com/calendar/v3/", nil)
+	if _, err := transport.RoundTrip(req.WithContext(ctx)); err != context.Canceled {
+		t.Errorf("expected the request to be cancelled, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("expected 1 attempt, got %d", attempts)
+	}
+}
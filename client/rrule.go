@@ -0,0 +1,185 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// recurrenceRule is the subset of an RFC 5545 RRULE understood by the local
+// provider: FREQ, INTERVAL, COUNT, UNTIL and, for daily and weekly rules,
+// BYDAY without ordinals.
+type recurrenceRule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	byDay    []time.Weekday
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday,
+	"MO": time.Monday,
+	"TU": time.Tuesday,
+	"WE": time.Wednesday,
+	"TH": time.Thursday,
+	"FR": time.Friday,
+	"SA": time.Saturday,
+}
+
+func parseRecurrenceRule(rule string) (recurrenceRule, error) {
+	r := recurrenceRule{interval: 1}
+	rule = strings.TrimPrefix(rule, "RRULE:")
+	for _, part := range strings.Split(rule, ";") {
+		keyValue := strings.SplitN(part, "=", 2)
+		if len(keyValue) != 2 {
+			return r, fmt.Errorf("malformed rule part '%v'", part)
+		}
+		key, value := strings.ToUpper(keyValue[0]), strings.ToUpper(keyValue[1])
+		switch key {
+		case "FREQ":
+			switch value {
+			case "MINUTELY", "HOURLY", "DAILY", "WEEKLY", "MONTHLY", "YEARLY":
+				r.freq = value
+			default:
+				return r, fmt.Errorf("FREQ '%v' is not supported", value)
+			}
+		case "INTERVAL":
+			interval, err := strconv.Atoi(value)
+			if err != nil || interval < 1 {
+				return r, fmt.Errorf("INTERVAL must be a positive integer")
+			}
+			r.interval = interval
+		case "COUNT":
+			count, err := strconv.Atoi(value)
+			if err != nil || count < 1 {
+				return r, fmt.Errorf("COUNT must be a positive integer")
+			}
+			r.count = count
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return r, err
+			}
+			r.until = until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := weekdays[day]
+				if !ok {
+					return r, fmt.Errorf("BYDAY '%v' is not supported", day)
+				}
+				r.byDay = append(r.byDay, weekday)
+			}
+		default:
+			return r, fmt.Errorf("%v is not supported", key)
+		}
+	}
+	if r.freq == "" {
+		return r, fmt.Errorf("FREQ must be specified")
+	}
+	if len(r.byDay) > 0 && r.freq != "DAILY" && r.freq != "WEEKLY" {
+		return r, fmt.Errorf("BYDAY is only supported with FREQ=DAILY or FREQ=WEEKLY")
+	}
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("UNTIL '%v' is not a valid date or UTC date-time", value)
+}
+
+// occurrences calls fn with the start time of each occurrence in order,
+// beginning with dtstart, until fn returns false, an occurrence would start
+// after limit or the rule is exhausted.
+func (r recurrenceRule) occurrences(dtstart, limit time.Time, fn func(time.Time) bool) {
+	emitted := 0
+	emit := func(t time.Time) bool {
+		if t.After(limit) {
+			return false
+		}
+		if !r.until.IsZero() && t.After(r.until) {
+			return false
+		}
+		if r.count > 0 && emitted >= r.count {
+			return false
+		}
+		emitted++
+		return fn(t)
+	}
+	for period := 0; ; period++ {
+		n := period * r.interval
+		switch r.freq {
+		case "MINUTELY":
+			if !emit(dtstart.Add(time.Duration(n) * time.Minute)) {
+				return
+			}
+		case "HOURLY":
+			if !emit(dtstart.Add(time.Duration(n) * time.Hour)) {
+				return
+			}
+		case "DAILY":
+			t := dtstart.AddDate(0, 0, n)
+			if t.After(limit) {
+				return
+			}
+			if r.matchesDay(t) && !emit(t) {
+				return
+			}
+		case "WEEKLY":
+			if len(r.byDay) == 0 {
+				if !emit(dtstart.AddDate(0, 0, 7*n)) {
+					return
+				}
+				continue
+			}
+			// Weeks start on Monday, the RFC 5545 default for WKST.
+			weekStart := dtstart.AddDate(0, 0, 7*n-(int(dtstart.Weekday())+6)%7)
+			if weekStart.After(limit) {
+				return
+			}
+			for offset := 0; offset < 7; offset++ {
+				t := weekStart.AddDate(0, 0, offset)
+				if t.Before(dtstart) || !r.matchesDay(t) {
+					continue
+				}
+				if !emit(t) {
+					return
+				}
+			}
+		case "MONTHLY", "YEARLY":
+			months := n
+			if r.freq == "YEARLY" {
+				months = 12 * n
+			}
+			t := dtstart.AddDate(0, months, 0)
+			if t.After(limit) {
+				return
+			}
+			// Dates which do not exist in a month, such as the 31st, are
+			// skipped rather than rolled into the next month.
+			if t.Day() != dtstart.Day() {
+				continue
+			}
+			if !emit(t) {
+				return
+			}
+		}
+	}
+}
+
+func (r recurrenceRule) matchesDay(t time.Time) bool {
+	if len(r.byDay) == 0 {
+		return true
+	}
+	for _, weekday := range r.byDay {
+		if t.Weekday() == weekday {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRecurrenceRuleErrors(t *testing.T) {
+	for _, test := range []struct {
+		rule        string
+		expectedErr string
+	}{
+		{"INTERVAL=2", "FREQ must be specified"},
+		{"FREQ=SECONDLY", "FREQ 'SECONDLY' is not supported"},
+		{"FREQ=DAILY;INTERVAL=0", "INTERVAL must be a positive integer"},
+		{"FREQ=DAILY;INTERVAL=two", "INTERVAL must be a positive integer"},
+		{"FREQ=DAILY;COUNT=-1", "COUNT must be a positive integer"},
+		{"FREQ=DAILY;UNTIL=tomorrow", "UNTIL 'TOMORROW' is not a valid date or UTC date-time"},
+		{"FREQ=WEEKLY;BYDAY=1MO", "BYDAY '1MO' is not supported"},
+		{"FREQ=MONTHLY;BYDAY=MO", "BYDAY is only supported with FREQ=DAILY or FREQ=WEEKLY"},
+		{"FREQ=DAILY;BYMONTH=1", "BYMONTH is not supported"},
+		{"FREQ=DAILY;COUNT", "malformed rule part 'COUNT'"},
+	} {
+		_, err := parseRecurrenceRule(test.rule)
+		if err == nil || !strings.Contains(err.Error(), test.expectedErr) {
+			t.Errorf("rule %v: expected error containing %q, got %v", test.rule, test.expectedErr, err)
+		}
+	}
+}
+
+func TestRecurrenceRuleOccurrences(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		rule     string
+		dtstart  string
+		limit    string
+		expected []string
+	}{
+		{
+			name:     "limited by COUNT",
+			rule:     "RRULE:FREQ=DAILY;COUNT=3",
+			dtstart:  "2016-10-24T09:00:00Z",
+			limit:    "2016-12-31T00:00:00Z",
+			expected: []string{"2016-10-24T09:00:00Z", "2016-10-25T09:00:00Z", "2016-10-26T09:00:00Z"},
+		},
+		{
+			name:     "limited by UNTIL",
+			rule:     "FREQ=HOURLY;UNTIL=20161024T110000Z",
+			dtstart:  "2016-10-24T09:00:00Z",
+			limit:    "2016-12-31T00:00:00Z",
+			expected: []string{"2016-10-24T09:00:00Z", "2016-10-24T10:00:00Z", "2016-10-24T11:00:00Z"},
+		},
+		{
+			name:     "limited by the limit",
+			rule:     "FREQ=MINUTELY;INTERVAL=15",
+			dtstart:  "2016-10-24T09:00:00Z",
+			limit:    "2016-10-24T09:40:00Z",
+			expected: []string{"2016-10-24T09:00:00Z", "2016-10-24T09:15:00Z", "2016-10-24T09:30:00Z"},
+		},
+		{
+			name:     "every other week",
+			rule:     "FREQ=WEEKLY;INTERVAL=2;COUNT=3",
+			dtstart:  "2016-10-24T09:00:00Z",
+			limit:    "2016-12-31T00:00:00Z",
+			expected: []string{"2016-10-24T09:00:00Z", "2016-11-07T09:00:00Z", "2016-11-21T09:00:00Z"},
+		},
+		{
+			// 2016-10-26 is a Wednesday, so the Monday of its week is skipped.
+			name:     "weekly on days other than the start's",
+			rule:     "FREQ=WEEKLY;BYDAY=MO,FR;COUNT=4",
+			dtstart:  "2016-10-26T09:00:00Z",
+			limit:    "2016-12-31T00:00:00Z",
+			expected: []string{"2016-10-28T09:00:00Z", "2016-10-31T09:00:00Z", "2016-11-04T09:00:00Z", "2016-11-07T09:00:00Z"},
+		},
+		{
+			name:     "daily on weekdays",
+			rule:     "FREQ=DAILY;BYDAY=MO,TU,WE,TH,FR;COUNT=3",
+			dtstart:  "2016-10-28T09:00:00Z",
+			limit:    "2016-12-31T00:00:00Z",
+			expected: []string{"2016-10-28T09:00:00Z", "2016-10-31T09:00:00Z", "2016-11-01T09:00:00Z"},
+		},
+		{
+			name:     "monthly on the 31st skips short months",
+			rule:     "FREQ=MONTHLY;COUNT=3",
+			dtstart:  "2016-01-31T09:00:00Z",
+			limit:    "2016-12-31T00:00:00Z",
+			expected: []string{"2016-01-31T09:00:00Z", "2016-03-31T09:00:00Z", "2016-05-31T09:00:00Z"},
+		},
+		{
+			name:     "yearly on a leap day",
+			rule:     "FREQ=YEARLY;COUNT=2",
+			dtstart:  "2016-02-29T09:00:00Z",
+			limit:    "2030-01-01T00:00:00Z",
+			expected: []string{"2016-02-29T09:00:00Z", "2020-02-29T09:00:00Z"},
+		},
+	} {
+		rule, err := parseRecurrenceRule(test.rule)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		occurrences := []string{}
+		rule.occurrences(mustParseTime(t, test.dtstart), mustParseTime(t, test.limit), func(occurrence time.Time) bool {
+			occurrences = append(occurrences, occurrence.UTC().Format(time.RFC3339))
+			return true
+		})
+		if !reflect.DeepEqual(occurrences, test.expected) {
+			t.Errorf("%v: expected occurrences %v, got %v", test.name, test.expected, occurrences)
+		}
+	}
+}
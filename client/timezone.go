@@ -0,0 +1,24 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	// The tz database is embedded so that time zones can be loaded even
+	// where the image has no tzdata installed.
+	_ "time/tzdata"
+)
+
+// loadLocation loads an IANA time zone such as "Europe/London". Unlike
+// time.LoadLocation it rejects the empty name and "Local", which depend on
+// the machine the resource happens to run on.
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("'%v' is not an IANA time zone", name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("'%v' is not an IANA time zone", name)
+	}
+	return loc, nil
+}
@@ -0,0 +1,170 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/henrytk/calendar-resource/client/googlefake"
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+	googleCalendarAPI "google.golang.org/api/calendar/v3"
+)
+
+func newTestGoogleProvider(t *testing.T, server *googlefake.Server, source models.Source) *GoogleCalendarClient {
+	source.Provider = "google"
+	source.Endpoint = server.URL
+	source.Credentials = server.Credentials()
+	provider, err := NewGoogleProvider(context.Background(), source, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func TestGoogleAllDayEventsAcrossDaylightSavingChanges(t *testing.T) {
+	for _, test := range []struct {
+		name             string
+		calendarTimeZone string
+		eventTimeZone    string
+		sourceTimeZone   string
+		date             string
+		endDate          string
+		expectedStart    string
+		expectedEnd      string
+	}{
+		{
+			name:             "in the calendar's time zone as clocks go back",
+			calendarTimeZone: "Europe/London",
+			date:             "2016-10-30",
+			endDate:          "2016-10-31",
+			expectedStart:    "2016-10-29T23:00:00Z",
+			expectedEnd:      "2016-10-31T00:00:00Z",
+		},
+		{
+			name:             "in the calendar's time zone as clocks go forward",
+			calendarTimeZone: "Europe/London",
+			date:             "2016-03-27",
+			endDate:          "2016-03-28",
+			expectedStart:    "2016-03-27T00:00:00Z",
+			expectedEnd:      "2016-03-27T23:00:00Z",
+		},
+		{
+			name:             "in the event's own time zone",
+			calendarTimeZone: "Europe/London",
+			eventTimeZone:    "America/New_York",
+			date:             "2016-11-06",
+			endDate:          "2016-11-07",
+			expectedStart:    "2016-11-06T04:00:00Z",
+			expectedEnd:      "2016-11-07T05:00:00Z",
+		},
+		{
+			name:             "in the source's time zone",
+			calendarTimeZone: "Europe/London",
+			eventTimeZone:    "America/New_York",
+			sourceTimeZone:   "Asia/Tokyo",
+			date:             "2016-10-30",
+			endDate:          "2016-10-31",
+			expectedStart:    "2016-10-29T15:00:00Z",
+			expectedEnd:      "2016-10-30T15:00:00Z",
+		},
+	} {
+		server := googlefake.NewServer()
+		server.TimeZone = test.calendarTimeZone
+		item := server.AddEvent(testCalendarId, &googleCalendarAPI.Event{
+			Summary: "Change freeze",
+			Start:   &googleCalendarAPI.EventDateTime{Date: test.date, TimeZone: test.eventTimeZone},
+			End:     &googleCalendarAPI.EventDateTime{Date: test.endDate, TimeZone: test.eventTimeZone},
+		})
+		provider := newTestGoogleProvider(t, server, models.Source{TimeZone: test.sourceTimeZone})
+
+		listed, err := provider.Events(context.Background(), testCalendarId, mustParseTime(t, "2016-01-01T00:00:00Z"), mustParseTime(t, "2017-01-01T00:00:00Z"))
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		fetched, err := provider.Event(context.Background(), testCalendarId, item.Id)
+		if err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		server.Close()
+
+		if len(listed) != 1 {
+			t.Errorf("%v: expected one event, got %v", test.name, len(listed))
+			continue
+		}
+		for _, event := range []models.Event{listed[0], fetched} {
+			if !event.AllDay {
+				t.Errorf("%v: expected an all-day event", test.name)
+			}
+			if start := event.Start.UTC().Format(time.RFC3339); start != test.expectedStart {
+				t.Errorf("%v: expected start %v, got %v", test.name, test.expectedStart, start)
+			}
+			if end := event.End.UTC().Format(time.RFC3339); end != test.expectedEnd {
+				t.Errorf("%v: expected end %v, got %v", test.name, test.expectedEnd, end)
+			}
+			if date := formatEventTime(event.Start, true); date != test.date {
+				t.Errorf("%v: expected date %v, got %v", test.name, test.date, date)
+			}
+		}
+	}
+}
+
+func TestLocalRecurrenceKeepsWallClockTimeAcrossDaylightSavingChanges(t *testing.T) {
+	provider := &LocalCalendarClient{
+		Source: models.Source{
+			TimeZone: "Europe/London",
+			Events: []models.LocalEvent{{
+				Id:      "standup",
+				Summary: "Standup",
+				Start:   "2016-10-24T09:00:00+01:00",
+				End:     "2016-10-24T09:15:00+01:00",
+				RRule:   "FREQ=WEEKLY",
+			}},
+		},
+	}
+	events, err := provider.Events(context.Background(), "", mustParseTime(t, "2016-10-20T00:00:00Z"), mustParseTime(t, "2016-11-04T00:00:00Z"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var starts []string
+	for _, event := range events {
+		starts = append(starts, event.Start.UTC().Format(time.RFC3339))
+	}
+	expected := []string{"2016-10-24T08:00:00Z", "2016-10-31T09:00:00Z"}
+	if len(starts) != len(expected) || starts[0] != expected[0] || starts[1] != expected[1] {
+		t.Errorf("expected occurrences starting %v, got %v", expected, starts)
+	}
+}
+
+func TestAddEventParamsRejectsInvalidTimeZones(t *testing.T) {
+	for _, timeZone := range []string{"Local", "BST", "Europe/Londn"} {
+		params := AddEventParams{
+			StartTime: "2016-10-24T13:00:00+01:00",
+			EndTime:   "2016-10-24T14:00:00+01:00",
+			TimeZone:  timeZone,
+		}
+		if _, err := params.Event(); err == nil {
+			t.Errorf("expected time zone '%v' to be rejected", timeZone)
+		}
+	}
+
+	params := AddEventParams{
+		StartTime: "2016-10-30T00:30:00+01:00",
+		EndTime:   "2016-10-30T03:00:00Z",
+		TimeZone:  "Europe/London",
+	}
+	event, err := params.Event()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if duration := event.End.Sub(event.Start); duration != 3*time.Hour+30*time.Minute {
+		t.Errorf("expected the event to last 3h30m across the clock change, got %v", duration)
+	}
+}
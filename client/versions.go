@@ -0,0 +1,172 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/henrytk/calendar-resource/models"
+)
+
+// Values for the initial_version source option.
+const (
+	InitialVersionAll    = "all"
+	InitialVersionLatest = "latest"
+	InitialVersionNone   = "none"
+)
+
+// Values for the mode source option.
+const (
+	ModeEvents   = "events"
+	ModeFreeBusy = "freebusy"
+)
+
+// Values for the trigger_on source option.
+const (
+	TriggerOnStart   = "start"
+	TriggerOnCreated = "created"
+	TriggerOnUpdated = "updated"
+	TriggerOnFree    = "free"
+	TriggerOnBusy    = "busy"
+)
+
+// initialMarkerId identifies the version emitted by the first check when
+// initial_version is none. It records when that check ran, so that events
+// starting later compare as newer, and get writes no metadata for it.
+const initialMarkerId = "initial_version"
+
+// changeFeedHorizon is how far ahead check looks for events which have been
+// created or updated when triggering on changes.
+const changeFeedHorizon = 366 * 24 * time.Hour
+
+// coalesceMaxLookback bounds how far back check looks for the start of a
+// window of coalesced events.
+const coalesceMaxLookback = 31 * 24 * time.Hour
+
+// newVersion builds a resource version for an event, recording its start
+// time in UTC so that versions compare consistently across check runs.
+func newVersion(id string, start time.Time) models.Version {
+	return models.Version{Id: id, Start: start.UTC().Format(time.RFC3339)}
+}
+
+type byStart []models.Version
+
+func (v byStart) Len() int      { return len(v) }
+func (v byStart) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v byStart) Less(i, j int) bool {
+	return versionLess(v[i], v[j])
+}
+
+func versionLess(a, b models.Version) bool {
+	aTime, bTime := versionTime(a), versionTime(b)
+	if !aTime.Equal(bTime) {
+		return aTime.Before(bTime)
+	}
+	if a.Id != b.Id {
+		return a.Id < b.Id
+	}
+	return a.CalendarId < b.CalendarId
+}
+
+// versionTime returns the time a version is ordered by: when its event
+// changed if triggering on changes, otherwise when its event starts.
+// Requested versions are checked by checkVersion first, so the times of all
+// versions can be parsed.
+func versionTime(version models.Version) time.Time {
+	t, _ := parseVersionTime(version)
+	return t
+}
+
+func parseVersionTime(version models.Version) (time.Time, error) {
+	value := version.Start
+	if version.Changed != "" {
+		value = version.Changed
+	}
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+// checkVersion returns an error if a version requested by Concourse has a
+// time which can't be parsed.
+func checkVersion(version models.Version) error {
+	if _, err := parseVersionTime(version); err != nil {
+		return fmt.Errorf("parsing version time: %v", err)
+	}
+	return nil
+}
+
+// sameVersion reports whether two versions identify the same event, and
+// the same change to it when triggering on changes.
+func sameVersion(a, b models.Version) bool {
+	return a.Id == b.Id && a.CalendarId == b.CalendarId && a.Changed == b.Changed
+}
+
+// versionsSince orders the available versions by time and returns the
+// requested version followed by every version newer than it, as Concourse
+// expects from check. If no version was requested the initialVersion setting
+// decides whether all versions, only the latest, or a marker for the time of
+// the check are returned.
+func versionsSince(requestedVersion models.Version, versions []models.Version, initialVersion string, now time.Time) []models.Version {
+	sort.Sort(byStart(versions))
+	if requestedVersion.Id == "" {
+		return initialVersions(versions, initialVersion, now)
+	}
+	if requestedVersion.Start == "" {
+		// Versions emitted before start times were recorded can only be
+		// located by their ID.
+		for i, version := range versions {
+			if sameVersion(version, requestedVersion) {
+				return versions[i:]
+			}
+		}
+		return versions
+	}
+	newerVersions := []models.Version{requestedVersion}
+	for _, version := range versions {
+		if sameVersion(version, requestedVersion) {
+			continue
+		}
+		if versionLess(requestedVersion, version) {
+			newerVersions = append(newerVersions, version)
+		}
+	}
+	return newerVersions
+}
+
+// debounce drops each version which comes less than interval after the
+// previous version kept. The first version, which is the requested version
+// if there is one, is always kept.
+func debounce(versions []models.Version, interval time.Duration) []models.Version {
+	if interval <= 0 || len(versions) == 0 {
+		return versions
+	}
+	kept := versions[:1]
+	for _, version := range versions[1:] {
+		if !versionTime(version).Before(versionTime(kept[len(kept)-1]).Add(interval)) {
+			kept = append(kept, version)
+		}
+	}
+	return kept
+}
+
+func initialVersions(versions []models.Version, initialVersion string, now time.Time) []models.Version {
+	// Source.Validate rejects other values, so anything else is treated as
+	// the default, all.
+	switch initialVersion {
+	case InitialVersionLatest:
+		if len(versions) == 0 {
+			return versions
+		}
+		return versions[len(versions)-1:]
+	case InitialVersionNone:
+		// Concourse sends no version until one is saved, so a marker is
+		// emitted for later checks to compare against. Versions record
+		// whole seconds, so it is rounded up to keep events which started
+		// earlier in the same second from comparing as newer.
+		return []models.Version{newVersion(initialMarkerId, now.Truncate(time.Second).Add(time.Second))}
+	default:
+		return versions
+	}
+}
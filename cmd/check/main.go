@@ -2,30 +2,58 @@ package main
 
 import (
 	"encoding/json"
+	"io"
 	"os"
 
 	"github.com/henrytk/calendar-resource/client"
 	"github.com/henrytk/calendar-resource/errors"
 	"github.com/henrytk/calendar-resource/models"
-	googleCalendarAPI "google.golang.org/api/calendar/v3"
+	"golang.org/x/net/context"
 )
 
 func main() {
-	var checkRequest models.CheckRequest
-	inputRequest(&checkRequest)
-	calendarClient := client.NewCalendarClient(checkRequest.Source, googleCalendarAPI.CalendarReadonlyScope)
-	currentVersions := calendarClient.ListEvents(checkRequest.Version)
-	outputResponse(currentVersions)
+	ctx, cancel := client.SignalContext()
+	status := Run(ctx, os.Stdin, os.Stdout, os.Stderr, os.Args[1:], client.NewCalendarClient)
+	cancel()
+	os.Exit(status)
 }
 
-func inputRequest(request *models.CheckRequest) {
-	if err := json.NewDecoder(os.Stdin).Decode(request); err != nil {
-		errors.Fatal("Reading request from standard input", err)
+// Run performs a check, reading the request from stdin and writing the
+// versions found to stdout. It returns the command's exit status.
+func Run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, args []string, newClient client.Factory) int {
+	var checkRequest models.CheckRequest
+	if err := json.NewDecoder(stdin).Decode(&checkRequest); err != nil {
+		errors.Report(stderr, "reading request from standard input", err)
+		return 1
+	}
+	if err := client.ValidateSource(checkRequest.Source); err != nil {
+		errors.Report(stderr, "validating source configuration", err)
+		return 1
+	}
+
+	ctx, cancel, err := client.NewContext(ctx, checkRequest.Source)
+	if err != nil {
+		errors.Report(stderr, "configuring timeout", err)
+		return 1
+	}
+	defer cancel()
+	calendarClient, err := newClient(ctx, checkRequest.Source, client.Options{Access: client.ReadOnly})
+	if err != nil {
+		errors.Report(stderr, "creating calendar client", err)
+		return 1
+	}
+	currentVersions, err := calendarClient.ListEvents(ctx, checkRequest.Version)
+	if err != nil {
+		errors.Report(stderr, "checking for new versions", err)
+		return 1
+	}
+	if currentVersions == nil {
+		currentVersions = []models.Version{}
 	}
-}
 
-func outputResponse(versions []models.Version) {
-	if err := json.NewEncoder(os.Stdout).Encode(versions); err != nil {
-		errors.Fatal("writing response to stdout", err)
+	if err := json.NewEncoder(stdout).Encode(currentVersions); err != nil {
+		errors.Report(stderr, "writing response to stdout", err)
+		return 1
 	}
+	return 0
 }
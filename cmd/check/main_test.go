@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/henrytk/calendar-resource/client"
+	"github.com/henrytk/calendar-resource/client/clientfake"
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+const validSource = `{
+	"provider": "google",
+	"calendar_id": "team@example.com",
+	"event_name": "Deploy",
+	"credentials": {"type": "service_account"}
+}`
+
+func TestRun(t *testing.T) {
+	versions := []models.Version{
+		{Id: "event1", Start: "2016-10-24T12:00:00Z"},
+		{Id: "event2", Start: "2016-10-24T13:00:00Z"},
+	}
+	for _, test := range []struct {
+		name             string
+		request          string
+		versions         []models.Version
+		expectedStatus   int
+		expectedVersions []models.Version
+		requestedVersion models.Version
+		factoryErr       error
+		clientErr        error
+		factory          client.Factory
+		expectedStderr   string
+	}{
+		{
+			name:             "without a version",
+			request:          `{"source": ` + validSource + `}`,
+			versions:         versions,
+			expectedVersions: versions,
+		},
+		{
+			name:             "with a version",
+			request:          `{"source": ` + validSource + `, "version": {"id": "event1", "start": "2016-10-24T12:00:00Z"}}`,
+			versions:         versions,
+			expectedVersions: versions,
+			requestedVersion: versions[0],
+		},
+		{
+			name:             "with no current events",
+			request:          `{"source": ` + validSource + `}`,
+			expectedVersions: []models.Version{},
+		},
+		{
+			name:           "with malformed JSON",
+			request:        `{"source":`,
+			expectedStatus: 1,
+			expectedStderr: "error reading request from standard input",
+		},
+		{
+			name:           "with an invalid source",
+			request:        `{"source": {"provider": "google", "calendar_id": "team@example.com"}}`,
+			expectedStatus: 1,
+			expectedStderr: "source.event_name must be set",
+		},
+		{
+			name:           "with an unknown source field",
+			request:        `{"source": {"provider": "google", "calendar_id": "team@example.com", "event_name": "Deploy", "credentials": {}, "calender_id": "x"}}`,
+			expectedStatus: 1,
+			expectedStderr: "unknown field source.calender_id",
+		},
+		{
+			name:           "when the client can't be created",
+			request:        `{"source": ` + validSource + `}`,
+			factoryErr:     fmt.Errorf("configuring credentials: bad key"),
+			expectedStatus: 1,
+			expectedStderr: "error creating calendar client: configuring credentials: bad key",
+		},
+		{
+			name:           "when listing events fails",
+			request:        `{"source": ` + validSource + `}`,
+			clientErr:      fmt.Errorf("getting events using calendar client: 503 Service Unavailable"),
+			expectedStatus: 1,
+			expectedStderr: "error checking for new versions: getting events using calendar client: 503 Service Unavailable",
+		},
+		{
+			name:           "with an unreadable credentials file",
+			request:        `{"source": {"provider": "google", "calendar_id": "team@example.com", "event_name": "Deploy", "credentials_file": "/nonexistent/credentials.json"}}`,
+			factory:        client.NewCalendarClient,
+			expectedStatus: 1,
+			expectedStderr: "error creating calendar client: resolving credentials",
+		},
+		{
+			name:           "with a local event which can't be evaluated",
+			request:        `{"source": {"provider": "local", "event_name": "Deploy", "events": [{"summary": "Deploy", "start": "2016-10-24T12:00:00Z", "end": "2016-10-24T13:00:00Z", "rrule": "FREQ=FORTNIGHTLY"}]}}`,
+			factory:        client.NewCalendarClient,
+			expectedStatus: 1,
+			expectedStderr: "error checking for new versions: getting events using calendar client: parsing rrule of local event 'Deploy'",
+		},
+	} {
+		calendarClient := &clientfake.CalendarClient{
+			Versions:   test.versions,
+			FactoryErr: test.factoryErr,
+			Err:        test.clientErr,
+		}
+		factory := test.factory
+		if factory == nil {
+			factory = calendarClient.Factory()
+		}
+		var stdout, stderr bytes.Buffer
+		status := Run(context.Background(), strings.NewReader(test.request), &stdout, &stderr, nil, factory)
+
+		if status != test.expectedStatus {
+			t.Errorf("%v: expected exit status %v, got %v: %v", test.name, test.expectedStatus, status, stderr.String())
+			continue
+		}
+		if !strings.Contains(stderr.String(), test.expectedStderr) {
+			t.Errorf("%v: expected stderr to contain '%v', got '%v'", test.name, test.expectedStderr, stderr.String())
+		}
+		if test.expectedStatus != 0 {
+			continue
+		}
+		var output []models.Version
+		if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+			t.Errorf("%v: decoding output: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(output, test.expectedVersions) {
+			t.Errorf("%v: expected versions %v, got %v", test.name, test.expectedVersions, output)
+		}
+		if calendarClient.RequestedVersion != test.requestedVersion {
+			t.Errorf("%v: expected requested version %v, got %v", test.name, test.requestedVersion, calendarClient.RequestedVersion)
+		}
+		if calendarClient.Options.Access != client.ReadOnly {
+			t.Errorf("%v: expected read-only access, got %v", test.name, calendarClient.Options.Access)
+		}
+	}
+}
@@ -3,44 +3,68 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/henrytk/calendar-resource/client"
 	"github.com/henrytk/calendar-resource/errors"
 	"github.com/henrytk/calendar-resource/models"
-	googleCalendarAPI "google.golang.org/api/calendar/v3"
+	"golang.org/x/net/context"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		errors.Fatal("command line input", fmt.Errorf("Must pass target directory as input"))
+	ctx, cancel := client.SignalContext()
+	status := Run(ctx, os.Stdin, os.Stdout, os.Stderr, os.Args[1:], client.NewCalendarClient)
+	cancel()
+	os.Exit(status)
+}
+
+// Run fetches the requested event into the target directory given as the
+// first argument, reading the request from stdin and writing the response to
+// stdout. It returns the command's exit status.
+func Run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, args []string, newClient client.Factory) int {
+	if len(args) < 1 {
+		errors.Report(stderr, "command line input", fmt.Errorf("Must pass target directory as input"))
+		return 1
 	}
 
-	targetDirectory := os.Args[1]
+	targetDirectory := args[0]
 	if err := os.MkdirAll(targetDirectory, 0755); err != nil {
-		errors.Fatal("creating target directory", err)
+		errors.Report(stderr, "creating target directory", err)
+		return 1
 	}
 
 	var inRequest models.InRequest
-	inputRequest(&inRequest)
-	calendarClient := client.NewCalendarClient(inRequest.Source, googleCalendarAPI.CalendarReadonlyScope)
-	inResponse, file, err := calendarClient.GetEvent(&inRequest, targetDirectory)
-	if err != nil {
-		errors.Fatal("getting event details for input file", err)
+	if err := json.NewDecoder(stdin).Decode(&inRequest); err != nil {
+		errors.Report(stderr, "reading request from standard input", err)
+		return 1
+	}
+	if err := client.ValidateSource(inRequest.Source); err != nil {
+		errors.Report(stderr, "validating source configuration", err)
+		return 1
 	}
-	defer file.Close()
-
-	outputResponse(&inResponse)
-}
 
-func inputRequest(request *models.InRequest) {
-	if err := json.NewDecoder(os.Stdin).Decode(request); err != nil {
-		errors.Fatal("reading request from standard input", err)
+	ctx, cancel, err := client.NewContext(ctx, inRequest.Source)
+	if err != nil {
+		errors.Report(stderr, "configuring timeout", err)
+		return 1
 	}
-}
+	defer cancel()
+	calendarClient, err := newClient(ctx, inRequest.Source, client.Options{Access: client.ReadOnly})
+	if err != nil {
+		errors.Report(stderr, "creating calendar client", err)
+		return 1
+	}
+	inResponse, file, err := calendarClient.GetEvent(ctx, &inRequest, targetDirectory)
+	if err != nil {
+		errors.Report(stderr, "getting event details for input file", err)
+		return 1
+	}
+	defer file.Close()
 
-func outputResponse(response *models.InResponse) {
-	if err := json.NewEncoder(os.Stdout).Encode(response); err != nil {
-		errors.Fatal("writing response to standard output", err)
+	if err := json.NewEncoder(stdout).Encode(&inResponse); err != nil {
+		errors.Report(stderr, "writing response to standard output", err)
+		return 1
 	}
+	return 0
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/henrytk/calendar-resource/client"
+	"github.com/henrytk/calendar-resource/client/clientfake"
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+const validSource = `{
+	"provider": "google",
+	"calendar_id": "team@example.com",
+	"event_name": "Deploy",
+	"credentials": {"type": "service_account"}
+}`
+
+func TestRun(t *testing.T) {
+	metaData := []models.KeyValuePair{
+		{Name: "summary", Value: "Deploy"},
+		{Name: "start", Value: "2016-10-24T13:00:00+01:00"},
+	}
+	for _, test := range []struct {
+		name           string
+		request        string
+		noArgs         bool
+		expectedStatus int
+		expected       models.InResponse
+		factoryErr     error
+		clientErr      error
+		expectedStderr string
+	}{
+		{
+			name:    "with a version",
+			request: `{"source": ` + validSource + `, "version": {"id": "event1", "start": "2016-10-24T12:00:00Z"}}`,
+			expected: models.InResponse{
+				Version:  models.Version{Id: "event1", Start: "2016-10-24T12:00:00Z"},
+				MetaData: metaData,
+			},
+		},
+		{
+			name:    "with params",
+			request: `{"source": ` + validSource + `, "version": {"id": "event1"}, "params": {}}`,
+			expected: models.InResponse{
+				Version:  models.Version{Id: "event1"},
+				MetaData: metaData,
+			},
+		},
+		{
+			name:           "with an unknown version",
+			request:        `{"source": ` + validSource + `, "version": {"id": "missing"}}`,
+			expectedStatus: 1,
+			expectedStderr: "event 'missing' not found",
+		},
+		{
+			name:           "without a target directory",
+			request:        `{"source": ` + validSource + `, "version": {"id": "event1"}}`,
+			noArgs:         true,
+			expectedStatus: 1,
+			expectedStderr: "Must pass target directory as input",
+		},
+		{
+			name:           "with malformed JSON",
+			request:        `{"source":`,
+			expectedStatus: 1,
+			expectedStderr: "error reading request from standard input",
+		},
+		{
+			name:           "with an invalid source",
+			request:        `{"source": {"provider": "outlook", "event_name": "Deploy"}, "version": {"id": "event1"}}`,
+			expectedStatus: 1,
+			expectedStderr: "source.provider 'outlook' is not supported",
+		},
+		{
+			name:           "when the client can't be created",
+			request:        `{"source": ` + validSource + `, "version": {"id": "event1"}}`,
+			factoryErr:     fmt.Errorf("configuring credentials: bad key"),
+			expectedStatus: 1,
+			expectedStderr: "error creating calendar client: configuring credentials: bad key",
+		},
+		{
+			name:           "when getting the event fails",
+			request:        `{"source": ` + validSource + `, "version": {"id": "event1"}}`,
+			clientErr:      fmt.Errorf("getting event using calendar client: 503 Service Unavailable"),
+			expectedStatus: 1,
+			expectedStderr: "error getting event details for input file: getting event using calendar client: 503 Service Unavailable",
+		},
+	} {
+		targetDirectory, err := ioutil.TempDir("", "calendar-resource-in")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(targetDirectory)
+		args := []string{targetDirectory}
+		if test.noArgs {
+			args = nil
+		}
+
+		calendarClient := &clientfake.CalendarClient{
+			MetaData:   map[string][]models.KeyValuePair{"event1": metaData},
+			FactoryErr: test.factoryErr,
+			Err:        test.clientErr,
+		}
+		var stdout, stderr bytes.Buffer
+		status := Run(context.Background(), strings.NewReader(test.request), &stdout, &stderr, args, calendarClient.Factory())
+
+		if status != test.expectedStatus {
+			t.Errorf("%v: expected exit status %v, got %v: %v", test.name, test.expectedStatus, status, stderr.String())
+			continue
+		}
+		if !strings.Contains(stderr.String(), test.expectedStderr) {
+			t.Errorf("%v: expected stderr to contain '%v', got '%v'", test.name, test.expectedStderr, stderr.String())
+		}
+		if test.expectedStatus != 0 {
+			continue
+		}
+		var output models.InResponse
+		if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+			t.Errorf("%v: decoding output: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(output, test.expected) {
+			t.Errorf("%v: expected response %v, got %v", test.name, test.expected, output)
+		}
+		if _, err := os.Stat(filepath.Join(targetDirectory, "input")); err != nil {
+			t.Errorf("%v: expected input file to be written: %v", test.name, err)
+		}
+		if calendarClient.Options.Access != client.ReadOnly {
+			t.Errorf("%v: expected ReadOnly access, got %v", test.name, calendarClient.Options.Access)
+		}
+	}
+}
@@ -3,35 +3,61 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/henrytk/calendar-resource/client"
 	"github.com/henrytk/calendar-resource/errors"
 	"github.com/henrytk/calendar-resource/models"
-	googleCalendarAPI "google.golang.org/api/calendar/v3"
+	"golang.org/x/net/context"
 )
 
 func main() {
-	if len(os.Args) < 2 {
-		errors.Fatal("command line input", fmt.Errorf("Must pass path to build sources"))
+	ctx, cancel := client.SignalContext()
+	status := Run(ctx, os.Stdin, os.Stdout, os.Stderr, os.Args[1:], client.NewCalendarClient)
+	cancel()
+	os.Exit(status)
+}
+
+// Run adds an event, given the path to the build sources as the first
+// argument, reading the request from stdin and writing the new version to
+// stdout. It returns the command's exit status.
+func Run(ctx context.Context, stdin io.Reader, stdout, stderr io.Writer, args []string, newClient client.Factory) int {
+	if len(args) < 1 {
+		errors.Report(stderr, "command line input", fmt.Errorf("Must pass path to build sources"))
+		return 1
 	}
 
 	var outRequest models.OutRequest
-	inputRequest(&outRequest)
-
-	calendarClient := client.NewCalendarClient(outRequest.Source, googleCalendarAPI.CalendarScope)
-	outResponse := calendarClient.AddEvent(&outRequest, os.Args[1])
-	outputResponse(&outResponse)
-}
+	if err := json.NewDecoder(stdin).Decode(&outRequest); err != nil {
+		errors.Report(stderr, "reading request from standard input", err)
+		return 1
+	}
+	if err := client.ValidateSource(outRequest.Source); err != nil {
+		errors.Report(stderr, "validating source configuration", err)
+		return 1
+	}
 
-func inputRequest(request *models.OutRequest) {
-	if err := json.NewDecoder(os.Stdin).Decode(request); err != nil {
-		errors.Fatal("reading request from standard input", err)
+	ctx, cancel, err := client.NewContext(ctx, outRequest.Source)
+	if err != nil {
+		errors.Report(stderr, "configuring timeout", err)
+		return 1
+	}
+	defer cancel()
+	calendarClient, err := newClient(ctx, outRequest.Source, client.Options{Access: client.ReadWrite})
+	if err != nil {
+		errors.Report(stderr, "creating calendar client", err)
+		return 1
+	}
+	outResponse, err := calendarClient.AddEvent(ctx, &outRequest, args[0])
+	if err != nil {
+		errors.Report(stderr, "adding event", err)
+		return 1
 	}
-}
 
-func outputResponse(response *models.OutResponse) {
-	if err := json.NewEncoder(os.Stdout).Encode(response); err != nil {
-		errors.Fatal("writing response to stdout", err)
+	if err := json.NewEncoder(stdout).Encode(&outResponse); err != nil {
+		errors.Report(stderr, "writing response to stdout", err)
+		return 1
 	}
+	return 0
 }
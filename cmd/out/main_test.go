@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/henrytk/calendar-resource/client"
+	"github.com/henrytk/calendar-resource/client/clientfake"
+	"github.com/henrytk/calendar-resource/models"
+	"golang.org/x/net/context"
+)
+
+const validSource = `{
+	"provider": "google",
+	"calendar_id": "team@example.com",
+	"event_name": "Deploy",
+	"credentials": {"type": "service_account"}
+}`
+
+func TestRun(t *testing.T) {
+	addedVersion := models.Version{Id: "event1", Start: "2016-10-24T12:00:00Z"}
+	for _, test := range []struct {
+		name           string
+		request        string
+		args           []string
+		expectedStatus int
+		expectedParams string
+		factoryErr     error
+		clientErr      error
+		expectedStderr string
+	}{
+		{
+			name:           "with params",
+			request:        `{"source": ` + validSource + `, "params": {"start_time": "2016-10-24T13:00:00+01:00", "end_time": "2016-10-24T14:00:00+01:00"}}`,
+			args:           []string{"/tmp/build"},
+			expectedParams: `{"start_time": "2016-10-24T13:00:00+01:00", "end_time": "2016-10-24T14:00:00+01:00"}`,
+		},
+		{
+			name:           "without a build sources path",
+			request:        `{"source": ` + validSource + `, "params": {}}`,
+			expectedStatus: 1,
+			expectedStderr: "Must pass path to build sources",
+		},
+		{
+			name:           "with malformed JSON",
+			request:        `{"source":`,
+			args:           []string{"/tmp/build"},
+			expectedStatus: 1,
+			expectedStderr: "error reading request from standard input",
+		},
+		{
+			name:           "with an invalid source",
+			request:        `{"source": {"provider": "google", "event_name": "Deploy", "credentials": {}}, "params": {}}`,
+			args:           []string{"/tmp/build"},
+			expectedStatus: 1,
+			expectedStderr: "one of source.calendar_id, source.calendar_ids or source.calendar_name must be set",
+		},
+		{
+			name:           "when the client can't be created",
+			request:        `{"source": ` + validSource + `, "params": {}}`,
+			args:           []string{"/tmp/build"},
+			factoryErr:     fmt.Errorf("configuring credentials: bad key"),
+			expectedStatus: 1,
+			expectedStderr: "error creating calendar client: configuring credentials: bad key",
+		},
+		{
+			name:           "when adding the event fails",
+			request:        `{"source": ` + validSource + `, "params": {}}`,
+			args:           []string{"/tmp/build"},
+			clientErr:      fmt.Errorf("You must supply an event start and end time"),
+			expectedStatus: 1,
+			expectedStderr: "error adding event: You must supply an event start and end time",
+		},
+	} {
+		calendarClient := &clientfake.CalendarClient{
+			AddedVersion: addedVersion,
+			FactoryErr:   test.factoryErr,
+			Err:          test.clientErr,
+		}
+		var stdout, stderr bytes.Buffer
+		status := Run(context.Background(), strings.NewReader(test.request), &stdout, &stderr, test.args, calendarClient.Factory())
+
+		if status != test.expectedStatus {
+			t.Errorf("%v: expected exit status %v, got %v: %v", test.name, test.expectedStatus, status, stderr.String())
+			continue
+		}
+		if !strings.Contains(stderr.String(), test.expectedStderr) {
+			t.Errorf("%v: expected stderr to contain '%v', got '%v'", test.name, test.expectedStderr, stderr.String())
+		}
+		if test.expectedStatus != 0 {
+			continue
+		}
+		var output models.OutResponse
+		if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+			t.Errorf("%v: decoding output: %v", test.name, err)
+			continue
+		}
+		if output.Version != addedVersion {
+			t.Errorf("%v: expected version %v, got %v", test.name, addedVersion, output.Version)
+		}
+		if string(calendarClient.OutRequest.Params) != test.expectedParams {
+			t.Errorf("%v: expected params %v, got %s", test.name, test.expectedParams, calendarClient.OutRequest.Params)
+		}
+		if calendarClient.BuildSourcePath != test.args[0] {
+			t.Errorf("%v: expected build sources path %v, got %v", test.name, test.args[0], calendarClient.BuildSourcePath)
+		}
+		if calendarClient.Options.Access != client.ReadWrite {
+			t.Errorf("%v: expected read-write access, got %v", test.name, calendarClient.Options.Access)
+		}
+	}
+}
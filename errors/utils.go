@@ -2,16 +2,23 @@ package errors
 
 import (
 	"fmt"
+	"io"
 	"os"
 
 	"github.com/mitchellh/colorstring"
 )
 
 func Fatal(doing string, err error) {
-	Sayf(colorstring.Color("[red]error %s: %s\n"), doing, err)
+	Report(os.Stderr, doing, err)
 	os.Exit(1)
 }
 
+// Report writes an error message to w in the same form as Fatal, without
+// exiting.
+func Report(w io.Writer, doing string, err error) {
+	fmt.Fprintf(w, colorstring.Color("[red]error %s: %s\n"), doing, err)
+}
+
 func Sayf(message string, args ...interface{}) {
 	fmt.Fprintf(os.Stderr, message, args...)
 }
@@ -0,0 +1,88 @@
+package models
+
+import (
+	"time"
+)
+
+// Event is the provider-neutral representation of a calendar event. Each
+// provider converts its own events to and from Event, so that matching,
+// versioning and output are implemented once for every provider.
+type Event struct {
+	Id          string `json:"id"`
+	CalendarId  string `json:"calendar_id,omitempty"`
+	Summary     string `json:"summary"`
+	Description string `json:"description,omitempty"`
+	Location    string `json:"location,omitempty"`
+
+	// Start and End are the event's bounds. For an all-day event they are
+	// midnight at the start of its first day and after its last day.
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	AllDay   bool      `json:"all_day,omitempty"`
+	TimeZone string    `json:"time_zone,omitempty"`
+
+	Created time.Time `json:"created,omitempty"`
+	Updated time.Time `json:"updated,omitempty"`
+
+	// Status is one of "confirmed", "tentative" or "cancelled".
+	Status string `json:"status,omitempty"`
+	// EventType is the provider's kind of event, such as Google's
+	// "default", "outOfOffice", "focusTime" or "workingLocation".
+	EventType string `json:"event_type,omitempty"`
+	// Transparency is "busy" if the event blocks time, otherwise "free".
+	Transparency string `json:"transparency,omitempty"`
+
+	Attendees  []Attendee `json:"attendees,omitempty"`
+	Recurrence []string   `json:"recurrence,omitempty"`
+
+	// Properties holds provider-specific details, such as links to the
+	// event, which have no equivalent in other providers.
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+// Attendee is a person or resource invited to an event. ResponseStatus is
+// one of "needsAction", "declined", "tentative" or "accepted". Self is set
+// for the attendee whose calendar the event was read from.
+type Attendee struct {
+	Email          string `json:"email"`
+	DisplayName    string `json:"display_name,omitempty"`
+	ResponseStatus string `json:"response_status,omitempty"`
+	Optional       bool   `json:"optional,omitempty"`
+	Resource       bool   `json:"resource,omitempty"`
+	Self           bool   `json:"self,omitempty"`
+}
+
+// Duration returns how long the event lasts.
+func (e Event) Duration() time.Duration {
+	return e.End.Sub(e.Start)
+}
+
+// Active reports whether the event is happening at the given time.
+func (e Event) Active(at time.Time) bool {
+	return !at.Before(e.Start) && at.Before(e.End)
+}
+
+// SelfResponse returns the response status of the attendee whose calendar
+// the event was read from. Events without that attendee, such as those the
+// owner created without inviting anyone, are treated as accepted.
+func (e Event) SelfResponse() string {
+	for _, attendee := range e.Attendees {
+		if attendee.Self {
+			return attendee.ResponseStatus
+		}
+	}
+	return "accepted"
+}
+
+// Period is a span of time, such as one during which a calendar is busy.
+type Period struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Calendar is a calendar the provider's account can access. Name is the
+// calendar's display name as seen by that account.
+type Calendar struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
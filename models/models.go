@@ -5,14 +5,150 @@ import (
 )
 
 type Source struct {
-	Provider    string          `json:"provider"`
-	CalendarId  string          `json:"calendar_id"`
+	Provider   string `json:"provider"`
+	CalendarId string `json:"calendar_id"`
+
+	// CalendarIds lists several calendars whose events are merged, as an
+	// alternative to CalendarId.
+	CalendarIds []string `json:"calendar_ids,omitempty"`
+
+	// CalendarName identifies the calendar by its display name, which is
+	// resolved to an ID at runtime.
+	CalendarName string `json:"calendar_name,omitempty"`
+
 	EventName   string          `json:"event_name"`
 	Credentials json.RawMessage `json:"credentials"`
+	Impersonate string          `json:"impersonate,omitempty"`
+
+	// QualifiedNames also matches events whose name is EventName followed
+	// by a colon and a qualifier, such as "On call: alice".
+	QualifiedNames bool `json:"qualified_names,omitempty"`
+
+	// Endpoint overrides the base URL of the provider's API, for example to
+	// use a local fake in tests.
+	Endpoint string `json:"endpoint,omitempty"`
+
+	// CredentialsFile and CredentialsEnv name a file or environment variable
+	// holding the credentials, as an alternative to supplying them inline.
+	CredentialsFile string `json:"credentials_file,omitempty"`
+	CredentialsEnv  string `json:"credentials_env,omitempty"`
+
+	// EventTypes, Statuses and Transparency restrict which events named
+	// EventName trigger: by the provider's event type, by status
+	// ("confirmed" or "tentative"), and by whether they are "busy" or
+	// "free". MinDuration and MaxDuration, such as "15m", bound how long
+	// they last. Unset filters match every event.
+	EventTypes   []string `json:"event_types,omitempty"`
+	Statuses     []string `json:"statuses,omitempty"`
+	Transparency string   `json:"transparency,omitempty"`
+	MinDuration  string   `json:"min_duration,omitempty"`
+	MaxDuration  string   `json:"max_duration,omitempty"`
+
+	// SkipDeclined ignores events the calendar's owner has declined.
+	// RequireResponse, "accepted" or "tentative", ignores events unless the
+	// owner has given at least that response.
+	SkipDeclined    bool   `json:"skip_declined,omitempty"`
+	RequireResponse string `json:"require_response,omitempty"`
+
+	// Mode is "events" to trigger on events named EventName, or "freebusy"
+	// to trigger on whether the people and resources whose calendars are
+	// configured are free or busy. Defaults to "events".
+	Mode string `json:"mode,omitempty"`
+
+	// TriggerOn is "start" to emit a version when a matching event starts,
+	// "created" to emit one when a matching event is scheduled, or
+	// "updated" to emit one whenever a matching event is scheduled or
+	// edited. Defaults to "start". In freebusy mode it is instead "free" to
+	// emit a version when every calendar becomes free, or "busy" to emit
+	// one when any calendar becomes busy, and defaults to "free".
+	TriggerOn string `json:"trigger_on,omitempty"`
+
+	// Lookback, such as "24h", makes check also emit events which ended
+	// within that long ago, so that events missed while checks weren't
+	// running still trigger.
+	Lookback string `json:"lookback,omitempty"`
+
+	// CoalesceGap, such as "15m", merges matching events which overlap or
+	// are separated by no more than the gap into one version, identified
+	// by the first event. MinInterval, such as "1h", drops versions which
+	// come less than the interval after the previous one.
+	CoalesceGap string `json:"coalesce_gap,omitempty"`
+	MinInterval string `json:"min_interval,omitempty"`
+
+	// InitialVersion controls which versions check emits when no version
+	// has been requested yet. It is one of "all", "latest" or "none".
+	InitialVersion string `json:"initial_version,omitempty"`
+
+	// Gate optionally names a second calendar whose events suppress new
+	// versions while they are happening, such as a change freeze calendar.
+	Gate *Gate `json:"gate,omitempty"`
+
+	// Events holds the event definitions used by the local provider.
+	Events []LocalEvent `json:"events,omitempty"`
+
+	// RetryAttempts and RetryTimeout bound how often and for how long a
+	// calendar API request failing with a transient error is retried.
+	// RetryTimeout is a duration such as "2m".
+	RetryAttempts int    `json:"retry_attempts,omitempty"`
+	RetryTimeout  string `json:"retry_timeout,omitempty"`
+
+	// Timeout bounds how long a command may run, such as "5m".
+	Timeout string `json:"timeout,omitempty"`
+
+	// TimeZone is an IANA time zone such as "Europe/London" which overrides
+	// the time zones of events and calendars when placing event times.
+	TimeZone string `json:"time_zone,omitempty"`
+
+	// Extra holds the raw values of top-level keys which are not fields of
+	// Source, such as the fields of a provider registered from another
+	// package. Validate rejects those the provider has not declared.
+	Extra map[string]json.RawMessage `json:"-"`
+
+	unknownKeys []string
 }
 
+// Gate identifies the events in another calendar which block triggers. If
+// EventName is empty any event in the calendar blocks. DiscardBlocked also
+// drops events which started while a blocking event was happening, rather
+// than letting them trigger once it ends.
+type Gate struct {
+	CalendarId     string `json:"calendar_id"`
+	EventName      string `json:"event_name,omitempty"`
+	DiscardBlocked bool   `json:"discard_blocked,omitempty"`
+}
+
+// LocalEvent defines an event evaluated in-process by the local provider.
+// Start and End must be RFC3339 formatted time strings. RRule optionally
+// makes the event recur, for example "FREQ=WEEKLY;BYDAY=MO,WE,FR".
+type LocalEvent struct {
+	Id          string `json:"id,omitempty"`
+	Summary     string `json:"summary"`
+	Description string `json:"description,omitempty"`
+	Start       string `json:"start"`
+	End         string `json:"end"`
+	TimeZone    string `json:"time_zone,omitempty"`
+	RRule       string `json:"rrule,omitempty"`
+}
+
+// Version identifies a calendar event. Start holds the event's start time
+// as an RFC3339 timestamp in UTC, which is used to order versions.
+// CalendarId is only set when the source has several calendars, and names
+// the calendar containing the event. Changed is only set when triggering on
+// created or updated events, and holds the time the event was created or
+// last updated; versions are then ordered by it instead of Start.
 type Version struct {
-	Id string `json:"id"`
+	Id         string `json:"id"`
+	Start      string `json:"start,omitempty"`
+	CalendarId string `json:"calendar_id,omitempty"`
+	Changed    string `json:"changed,omitempty"`
+}
+
+// Calendars returns the IDs of the calendars the source reads events from.
+func (s Source) Calendars() []string {
+	if len(s.CalendarIds) > 0 {
+		return s.CalendarIds
+	}
+	return []string{s.CalendarId}
 }
 
 type CheckRequest struct {
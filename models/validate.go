@@ -0,0 +1,207 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UnmarshalJSON decodes a Source. Top-level keys which do not correspond to
+// a field are kept in Extra, and unknown keys of nested objects are
+// recorded, so that Validate can report them.
+func (s *Source) UnmarshalJSON(data []byte) error {
+	type source Source
+	var decoded source
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	extraKeys, err := findUnknownKeys(data, decoded, "")
+	if err != nil {
+		return err
+	}
+	var extra map[string]json.RawMessage
+	if len(extraKeys) > 0 {
+		var object map[string]json.RawMessage
+		if err := json.Unmarshal(data, &object); err != nil {
+			return err
+		}
+		extra = map[string]json.RawMessage{}
+		for _, key := range extraKeys {
+			extra[key] = object[key]
+		}
+	}
+	var unknown []string
+	var nested struct {
+		Gate   json.RawMessage   `json:"gate"`
+		Events []json.RawMessage `json:"events"`
+	}
+	if err := json.Unmarshal(data, &nested); err != nil {
+		return err
+	}
+	if len(nested.Gate) > 0 && string(nested.Gate) != "null" {
+		keys, err := findUnknownKeys(nested.Gate, Gate{}, "gate.")
+		if err != nil {
+			return err
+		}
+		unknown = append(unknown, keys...)
+	}
+	for i, event := range nested.Events {
+		keys, err := findUnknownKeys(event, LocalEvent{}, fmt.Sprintf("events[%d].", i))
+		if err != nil {
+			return err
+		}
+		unknown = append(unknown, keys...)
+	}
+	*s = Source(decoded)
+	s.Extra = extra
+	s.unknownKeys = unknown
+	return nil
+}
+
+// findUnknownKeys returns the keys of the JSON object in data which are not
+// the JSON name of any field of v, each prefixed with prefix.
+func findUnknownKeys(data []byte, v interface{}, prefix string) ([]string, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	known := map[string]bool{}
+	t := reflect.TypeOf(v)
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			known[name] = true
+		}
+	}
+	var keys []string
+	for key := range object {
+		if !known[key] {
+			keys = append(keys, prefix+key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Validate checks the fields common to every provider and that no unknown
+// fields were supplied, other than the top-level keys in allowed. Errors
+// name the offending field. Fields specific to a provider are checked by
+// the provider's validator.
+func (s Source) Validate(allowed ...string) error {
+	var unknown []string
+	for key := range s.Extra {
+		if !containsKey(allowed, key) {
+			unknown = append(unknown, key)
+		}
+	}
+	sort.Strings(unknown)
+	unknown = append(unknown, s.unknownKeys...)
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown field source.%v", strings.Join(unknown, ", source."))
+	}
+	switch s.Mode {
+	case "", "events":
+		if s.EventName == "" {
+			return fmt.Errorf("source.event_name must be set")
+		}
+		switch s.TriggerOn {
+		case "", "start", "created", "updated":
+		default:
+			return fmt.Errorf("source.trigger_on must be start, created or updated, got '%v'", s.TriggerOn)
+		}
+	case "freebusy":
+		switch s.TriggerOn {
+		case "", "free", "busy":
+		default:
+			return fmt.Errorf("source.trigger_on must be free or busy in freebusy mode, got '%v'", s.TriggerOn)
+		}
+	default:
+		return fmt.Errorf("source.mode must be events or freebusy, got '%v'", s.Mode)
+	}
+	switch s.InitialVersion {
+	case "", "all", "latest", "none":
+	default:
+		return fmt.Errorf("source.initial_version must be one of all, latest or none, got '%v'", s.InitialVersion)
+	}
+	for i, status := range s.Statuses {
+		if status != "confirmed" && status != "tentative" {
+			return fmt.Errorf("source.statuses[%d] must be confirmed or tentative, got '%v'", i, status)
+		}
+	}
+	switch s.Transparency {
+	case "", "busy", "free":
+	default:
+		return fmt.Errorf("source.transparency must be busy or free, got '%v'", s.Transparency)
+	}
+	switch s.RequireResponse {
+	case "", "accepted", "tentative":
+	default:
+		return fmt.Errorf("source.require_response must be accepted or tentative, got '%v'", s.RequireResponse)
+	}
+	if err := validateDuration("source.lookback", s.Lookback); err != nil {
+		return err
+	}
+	if err := validateDuration("source.coalesce_gap", s.CoalesceGap); err != nil {
+		return err
+	}
+	if s.CoalesceGap != "" && (s.Mode == "freebusy" || (s.TriggerOn != "" && s.TriggerOn != "start")) {
+		return fmt.Errorf("source.coalesce_gap is only supported when triggering on the start of events")
+	}
+	if err := validateDuration("source.min_interval", s.MinInterval); err != nil {
+		return err
+	}
+	if err := validateDuration("source.min_duration", s.MinDuration); err != nil {
+		return err
+	}
+	if err := validateDuration("source.max_duration", s.MaxDuration); err != nil {
+		return err
+	}
+	if s.MinDuration != "" && s.MaxDuration != "" {
+		minDuration, _ := time.ParseDuration(s.MinDuration)
+		maxDuration, _ := time.ParseDuration(s.MaxDuration)
+		if minDuration > maxDuration {
+			return fmt.Errorf("source.min_duration must not be greater than source.max_duration")
+		}
+	}
+	if s.RetryAttempts < 0 {
+		return fmt.Errorf("source.retry_attempts must not be negative")
+	}
+	if err := validateDuration("source.retry_timeout", s.RetryTimeout); err != nil {
+		return err
+	}
+	if err := validateDuration("source.timeout", s.Timeout); err != nil {
+		return err
+	}
+	if s.TimeZone != "" {
+		if _, err := time.LoadLocation(s.TimeZone); err != nil || s.TimeZone == "Local" {
+			return fmt.Errorf("source.time_zone must be an IANA time zone such as \"Europe/London\", got '%v'", s.TimeZone)
+		}
+	}
+	return nil
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+func validateDuration(field, duration string) error {
+	if duration == "" {
+		return nil
+	}
+	d, err := time.ParseDuration(duration)
+	if err != nil {
+		return fmt.Errorf("%v must be a duration such as \"1m30s\", got '%v'", field, duration)
+	}
+	if d < 0 {
+		return fmt.Errorf("%v must not be negative", field)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestSourceValidate(t *testing.T) {
+	for _, test := range []struct {
+		name          string
+		source        string
+		allowed       []string
+		expectedError string
+	}{
+		{
+			name:   "with the minimum fields",
+			source: `{"event_name": "Deploy"}`,
+		},
+		{
+			name:          "without event_name",
+			source:        `{}`,
+			expectedError: "source.event_name must be set",
+		},
+		{
+			name:          "with unknown fields",
+			source:        `{"event_name": "Deploy", "calender_id": "x", "eventname": "y"}`,
+			expectedError: "unknown field source.calender_id, source.eventname",
+		},
+		{
+			name:          "with an unknown gate field",
+			source:        `{"event_name": "Deploy", "gate": {"calendar_id": "freeze", "name": "Freeze"}}`,
+			expectedError: "unknown field source.gate.name",
+		},
+		{
+			name:          "with an unknown local event field",
+			source:        `{"event_name": "Deploy", "events": [{"summary": "Deploy"}, {"summary": "Deploy", "rule": "FREQ=DAILY"}]}`,
+			expectedError: "unknown field source.events[1].rule",
+		},
+		{
+			name:    "with a field allowed by the provider",
+			source:  `{"event_name": "Deploy", "tenant_id": "contoso"}`,
+			allowed: []string{"tenant_id"},
+		},
+		{
+			name:          "with a field allowed by the provider and an unknown field",
+			source:        `{"event_name": "Deploy", "tenant_id": "contoso", "tenant": "contoso"}`,
+			allowed:       []string{"tenant_id"},
+			expectedError: "unknown field source.tenant",
+		},
+		{
+			name:   "triggering on created events",
+			source: `{"event_name": "Deploy", "mode": "events", "trigger_on": "created"}`,
+		},
+		{
+			name:   "triggering on updated events",
+			source: `{"event_name": "Deploy", "trigger_on": "updated"}`,
+		},
+		{
+			name:          "triggering on free calendars in events mode",
+			source:        `{"event_name": "Deploy", "trigger_on": "free"}`,
+			expectedError: "source.trigger_on must be start, created or updated, got 'free'",
+		},
+		{
+			name:   "triggering on busy calendars in freebusy mode",
+			source: `{"mode": "freebusy", "trigger_on": "busy"}`,
+		},
+		{
+			name:          "triggering on the start of events in freebusy mode",
+			source:        `{"mode": "freebusy", "trigger_on": "start"}`,
+			expectedError: "source.trigger_on must be free or busy in freebusy mode, got 'start'",
+		},
+		{
+			name:          "with an unknown mode",
+			source:        `{"event_name": "Deploy", "mode": "busy"}`,
+			expectedError: "source.mode must be events or freebusy, got 'busy'",
+		},
+		{
+			name:          "with an unknown initial_version",
+			source:        `{"event_name": "Deploy", "initial_version": "first"}`,
+			expectedError: "source.initial_version must be one of all, latest or none, got 'first'",
+		},
+		{
+			name:          "with an unknown status",
+			source:        `{"event_name": "Deploy", "statuses": ["confirmed", "cancelled"]}`,
+			expectedError: "source.statuses[1] must be confirmed or tentative, got 'cancelled'",
+		},
+		{
+			name:          "with an unknown transparency",
+			source:        `{"event_name": "Deploy", "transparency": "opaque"}`,
+			expectedError: "source.transparency must be busy or free, got 'opaque'",
+		},
+		{
+			name:          "with an unknown require_response",
+			source:        `{"event_name": "Deploy", "require_response": "declined"}`,
+			expectedError: "source.require_response must be accepted or tentative, got 'declined'",
+		},
+		{
+			name:   "with every duration set",
+			source: `{"event_name": "Deploy", "lookback": "24h", "coalesce_gap": "0s", "min_interval": "1h", "min_duration": "15m", "max_duration": "2h", "retry_timeout": "30s", "timeout": "5m"}`,
+		},
+		{
+			name:          "with a malformed lookback",
+			source:        `{"event_name": "Deploy", "lookback": "1 day"}`,
+			expectedError: `source.lookback must be a duration such as "1m30s", got '1 day'`,
+		},
+		{
+			name:          "with a negative lookback",
+			source:        `{"event_name": "Deploy", "lookback": "-1h"}`,
+			expectedError: "source.lookback must not be negative",
+		},
+		{
+			name:          "with a malformed coalesce_gap",
+			source:        `{"event_name": "Deploy", "coalesce_gap": "15"}`,
+			expectedError: `source.coalesce_gap must be a duration such as "1m30s", got '15'`,
+		},
+		{
+			name:          "coalescing in freebusy mode",
+			source:        `{"mode": "freebusy", "coalesce_gap": "15m"}`,
+			expectedError: "source.coalesce_gap is only supported when triggering on the start of events",
+		},
+		{
+			name:          "coalescing when triggering on updated events",
+			source:        `{"event_name": "Deploy", "trigger_on": "updated", "coalesce_gap": "15m"}`,
+			expectedError: "source.coalesce_gap is only supported when triggering on the start of events",
+		},
+		{
+			name:          "with a negative min_interval",
+			source:        `{"event_name": "Deploy", "min_interval": "-1h"}`,
+			expectedError: "source.min_interval must not be negative",
+		},
+		{
+			name:          "with a malformed min_duration",
+			source:        `{"event_name": "Deploy", "min_duration": "short"}`,
+			expectedError: `source.min_duration must be a duration such as "1m30s", got 'short'`,
+		},
+		{
+			name:          "with a malformed max_duration",
+			source:        `{"event_name": "Deploy", "max_duration": "long"}`,
+			expectedError: `source.max_duration must be a duration such as "1m30s", got 'long'`,
+		},
+		{
+			name:          "with min_duration greater than max_duration",
+			source:        `{"event_name": "Deploy", "min_duration": "2h", "max_duration": "1h"}`,
+			expectedError: "source.min_duration must not be greater than source.max_duration",
+		},
+		{
+			name:   "with min_duration equal to max_duration",
+			source: `{"event_name": "Deploy", "min_duration": "1h", "max_duration": "60m"}`,
+		},
+		{
+			name:          "with negative retry_attempts",
+			source:        `{"event_name": "Deploy", "retry_attempts": -1}`,
+			expectedError: "source.retry_attempts must not be negative",
+		},
+		{
+			name:          "with a malformed retry_timeout",
+			source:        `{"event_name": "Deploy", "retry_timeout": "30"}`,
+			expectedError: `source.retry_timeout must be a duration such as "1m30s", got '30'`,
+		},
+		{
+			name:          "with a negative timeout",
+			source:        `{"event_name": "Deploy", "timeout": "-5m"}`,
+			expectedError: "source.timeout must not be negative",
+		},
+		{
+			name:   "with a time_zone",
+			source: `{"event_name": "Deploy", "time_zone": "Europe/London"}`,
+		},
+		{
+			name:          "with an unknown time_zone",
+			source:        `{"event_name": "Deploy", "time_zone": "Europe/Londres"}`,
+			expectedError: `source.time_zone must be an IANA time zone such as "Europe/London", got 'Europe/Londres'`,
+		},
+		{
+			name:          "with the Local time_zone",
+			source:        `{"event_name": "Deploy", "time_zone": "Local"}`,
+			expectedError: `source.time_zone must be an IANA time zone such as "Europe/London", got 'Local'`,
+		},
+	} {
+		var source Source
+		if err := json.Unmarshal([]byte(test.source), &source); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		err := source.Validate(test.allowed...)
+		if test.expectedError == "" {
+			if err != nil {
+				t.Errorf("%v: expected no error, got %v", test.name, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != test.expectedError {
+			t.Errorf("%v: expected error %q, got %v", test.name, test.expectedError, err)
+		}
+	}
+}